@@ -0,0 +1,107 @@
+package framework
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrMainnetConfirmationRequired is returned by destructive operations on mainnet unless
+// models.Config.AllowMainnetDestructiveOperations is set or the ConfirmMainnet option is given
+var ErrMainnetConfirmationRequired = fmt.Errorf("Destructive operations on mainnet require AllowMainnetDestructiveOperations to be set")
+
+// DestructiveOption changes how a destructive operation, such as SelfDestruct, is guarded
+type DestructiveOption func(*destructiveOptions)
+
+type destructiveOptions struct {
+	confirmMainnet bool
+}
+
+// ConfirmMainnet allows a single destructive operation on mainnet, without setting
+// models.Config.AllowMainnetDestructiveOperations for every operation
+func ConfirmMainnet() DestructiveOption {
+	return func(options *destructiveOptions) {
+		options.confirmMainnet = true
+	}
+}
+
+// CanisterStatus is the state of the oracle canister as seen by the owner identity
+type CanisterStatus struct {
+	Status string // output of `dfx canister status`
+	Role   string // role of the current identity, as returned by the canister's my_role method
+}
+
+// RunOnce performs a single update round, retrieving and publishing the value of every key, and aborting the round if
+// the given context is cancelled. It returns an error listing the keys that were not updated, if any.
+func (o *Oracle) RunOnce(ctx context.Context) error {
+	return o.updateOracle(ctx)
+}
+
+// Status returns the status of the oracle canister and the role of the current identity
+func (o *Oracle) Status() (*CanisterStatus, error) {
+	status, err := o.dfxService.getCanisterStatus()
+	if err != nil {
+		return nil, err
+	}
+	role, err := o.dfxService.getMyRole()
+	if err != nil {
+		return nil, err
+	}
+	return &CanisterStatus{Status: status, Role: role}, nil
+}
+
+// ReadValue returns the Candid representation of every field of the given key stored in the canister
+func (o *Oracle) ReadValue(key string) (string, error) {
+	return o.dfxService.getMapValue(key)
+}
+
+// ReadFieldValue returns the Candid representation of the given field of the given key stored in the canister
+func (o *Oracle) ReadFieldValue(key string, field string) (string, error) {
+	return o.dfxService.getMapFieldValue(key, field)
+}
+
+// AddWriter assigns the writer role to the given principal
+func (o *Oracle) AddWriter(principal string) error {
+	return o.dfxService.assignWriterRole(principal)
+}
+
+// RevokeWriter revokes the writer role from the given principal
+func (o *Oracle) RevokeWriter(principal string, options ...DestructiveOption) error {
+	if err := o.checkDestructiveOperationAllowed(options); err != nil {
+		return err
+	}
+	return o.dfxService.revokeWriterRole(principal)
+}
+
+// RotateWriter makes the given DFX identity the writer, creating it if it doesn't exist, then revokes the writer role of
+// the previous writer identity. The new identity is recorded in the project directory, so a running oracle, in this
+// process or another, switches over to it without interrupting its writes, and later processes keep using it.
+func (o *Oracle) RotateWriter(newIdentity string, options ...DestructiveOption) error {
+	if err := o.checkDestructiveOperationAllowed(options); err != nil {
+		return err
+	}
+	return o.dfxService.rotateWriter(newIdentity)
+}
+
+// ListRoles returns the Candid representation of every principal with a role in the canister, other than the owner
+func (o *Oracle) ListRoles() (string, error) {
+	return o.dfxService.getRoles()
+}
+
+// SelfDestruct permanently disables the oracle canister, deleting its data; this cannot be undone
+func (o *Oracle) SelfDestruct(options ...DestructiveOption) error {
+	if err := o.checkDestructiveOperationAllowed(options); err != nil {
+		return err
+	}
+	return o.dfxService.selfDestruct()
+}
+
+func (o *Oracle) checkDestructiveOperationAllowed(options []DestructiveOption) error {
+	var allowed destructiveOptions
+	for _, option := range options {
+		option(&allowed)
+	}
+	if o.config.IsMainnetNetwork(o.dfxService.projectNetworks()) && !o.config.AllowMainnetDestructiveOperations && !allowed.confirmMainnet {
+		return ErrMainnetConfirmationRequired
+	}
+	return nil
+}
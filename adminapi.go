@@ -0,0 +1,154 @@
+package framework
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hyplabs/dfinity-oracle-framework/config"
+)
+
+// maxKeyDocumentSize limits the size of key documents sent to the admin API
+const maxKeyDocumentSize = 1 << 20
+
+// SetRegistry sets the registry used to resolve summarizers and other functions by name in keys added through the
+// admin API, which defaults to one with only the built-in functions
+func (o *Oracle) SetRegistry(registry *config.Registry) {
+	o.engineMu.Lock()
+	defer o.engineMu.Unlock()
+	o.registry = registry
+}
+
+// AdminHandler returns the admin API, requiring the configured AdminToken as a bearer token if it is set. It returns an
+// error if AdminAddress is a TCP address and no token is set. The endpoints are:
+//
+//	GET    /keys                list the configuration of every key
+//	PUT    /keys/{key}          add or replace a key, given as a JSON document like an entry of `keys` in a configuration file
+//	DELETE /keys/{key}          remove a key
+//	POST   /keys/{key}/pause    stop updating a key
+//	POST   /keys/{key}/resume   resume updating a paused key
+//	POST   /keys/{key}/update   update a key immediately, returning its status
+//
+// Keys containing "/" must be escaped as "%2F".
+func (o *Oracle) AdminHandler() (http.Handler, error) {
+	if o.config.AdminToken == "" && o.config.AdminAddress != "" && !strings.HasPrefix(o.config.AdminAddress, "unix:") {
+		return nil, fmt.Errorf("AdminToken must be set to serve the admin API on TCP address %s", o.config.AdminAddress)
+	}
+	return http.HandlerFunc(o.serveAdmin), nil
+}
+
+func (o *Oracle) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if token := o.config.AdminToken; token != "" {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeJSONError(w, http.StatusUnauthorized, fmt.Errorf("Missing or invalid bearer token"))
+			return
+		}
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if segments[0] != "keys" || len(segments) > 3 {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("Not found"))
+		return
+	}
+	if len(segments) == 1 {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method not allowed"))
+			return
+		}
+		writeJSON(w, http.StatusOK, o.Keys())
+		return
+	}
+	key, err := url.PathUnescape(segments[1])
+	if err != nil || key == "" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("Invalid key"))
+		return
+	}
+
+	action := r.Method
+	if len(segments) == 3 {
+		if r.Method != http.MethodPost {
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("Method not allowed"))
+			return
+		}
+		action = segments[2]
+	}
+	switch action {
+	case http.MethodPut:
+		err = o.setKeyDocument(r, key)
+	case http.MethodDelete:
+		err = o.RemoveKey(key)
+	case "pause":
+		err = o.PauseKey(key)
+	case "resume":
+		err = o.ResumeKey(key)
+	case "update":
+		if err = o.UpdateKey(r.Context(), key); err == nil || !errors.Is(err, ErrUnknownKey) {
+			o.writeKeyStatus(w, key, err)
+			return
+		}
+	default:
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("Not found"))
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrUnknownKey):
+		writeJSONError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeJSONError(w, http.StatusBadRequest, err)
+	default:
+		for _, info := range o.Keys() {
+			if info.Key == key {
+				writeJSON(w, http.StatusOK, info)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// setKeyDocument adds or replaces a key from the document in the request body
+func (o *Oracle) setKeyDocument(r *http.Request, key string) error {
+	document, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxKeyDocumentSize))
+	if err != nil {
+		return fmt.Errorf("Could not read key document: %w", err)
+	}
+	o.engineMu.RLock()
+	registry := o.registry
+	o.engineMu.RUnlock()
+	meta, err := config.ParseKey(document, config.JSON, registry)
+	if err != nil {
+		return err
+	}
+	if meta.Key != key {
+		return fmt.Errorf("Key %q in the document does not match key %q in the path", meta.Key, key)
+	}
+	return o.SetKey(meta)
+}
+
+// writeKeyStatus responds with the status of a key after updating it, which includes the error if the update failed
+func (o *Oracle) writeKeyStatus(w http.ResponseWriter, key string, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusBadGateway
+	}
+	if err == nil {
+		err = fmt.Errorf("No status for key %q", key)
+	}
+	for _, keyStatus := range o.ServiceStatus().Keys {
+		if keyStatus.Key == key {
+			writeJSON(w, status, keyStatus)
+			return
+		}
+	}
+	writeJSONError(w, status, err)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
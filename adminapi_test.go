@@ -0,0 +1,108 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func adminRequest(t *testing.T, handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdminAPIManagesKeys(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"price": 2.5}`))
+	}))
+	defer server.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "ETH/USD", Endpoints: []models.Endpoint{{Endpoint: server.URL, JSONPaths: map[string]string{"price": "$.price"}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: ".", AdminAddress: "127.0.0.1:0", AdminToken: "secret"}, engine)
+	handler, err := o.AdminHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := adminRequest(t, handler, "PUT", "/keys/ETH%2FBTC", `{"key": "ETH/BTC", "derived": {"expressions": {"price": "[ETH/USD].price / 2"}}}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Could not add key: %d %s", recorder.Code, recorder.Body)
+	}
+	recorder = adminRequest(t, handler, "POST", "/keys/ETH%2FUSD/pause", "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Could not pause key: %d %s", recorder.Code, recorder.Body)
+	}
+
+	var keys []KeyInfo
+	json.Unmarshal(adminRequest(t, handler, "GET", "/keys", "").Body.Bytes(), &keys)
+	if len(keys) != 2 || keys[0].Key != "ETH/USD" || !keys[0].Paused || keys[1].Derived == nil || keys[1].Derived.DependsOn[0] != "ETH/USD" {
+		t.Errorf("Incorrect keys %+v", keys)
+	}
+
+	// the paused key is skipped, so the key derived from it can't be updated either
+	o.RunOnce(context.Background())
+	status := o.ServiceStatus()
+	if len(status.Keys) != 1 || status.Keys[0].Key != "ETH/BTC" || status.Keys[0].Success {
+		t.Errorf("Expected only the derived key to be updated and fail, got %+v", status.Keys)
+	}
+
+	recorder = adminRequest(t, handler, "POST", "/keys/ETH%2FUSD/update", "")
+	var keyStatus KeyStatus
+	json.Unmarshal(recorder.Body.Bytes(), &keyStatus)
+	if recorder.Code != http.StatusOK || !keyStatus.Success || keyStatus.PublishedValues["price"] != 2.5 {
+		t.Errorf("Could not update key immediately: %d %s", recorder.Code, recorder.Body)
+	}
+	recorder = adminRequest(t, handler, "POST", "/keys/ETH%2FBTC/update", "")
+	json.Unmarshal(recorder.Body.Bytes(), &keyStatus)
+	if recorder.Code != http.StatusOK || keyStatus.PublishedValues["price"] != 1.25 {
+		t.Errorf("Could not update derived key immediately: %d %s", recorder.Code, recorder.Body)
+	}
+
+	if recorder = adminRequest(t, handler, "DELETE", "/keys/ETH%2FUSD", ""); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected removing a dependency to fail, got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder = adminRequest(t, handler, "DELETE", "/keys/ETH%2FBTC", ""); recorder.Code != http.StatusNoContent {
+		t.Errorf("Could not remove key: %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder = adminRequest(t, handler, "POST", "/keys/ETH%2FBTC/resume", ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown key, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	o := newTestOracle(t, &models.Config{CanisterName: ".", AdminAddress: "127.0.0.1:0"}, &models.Engine{})
+	if _, err := o.AdminHandler(); err == nil {
+		t.Errorf("Expected an error for a TCP admin address without a token")
+	}
+
+	o = newTestOracle(t, &models.Config{CanisterName: ".", AdminAddress: "127.0.0.1:0", AdminToken: "other"}, &models.Engine{})
+	handler, _ := o.AdminHandler()
+	if recorder := adminRequest(t, handler, "GET", "/keys", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an invalid token to be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestAdminAPIRejectsInvalidKeys(t *testing.T) {
+	o := newTestOracle(t, &models.Config{CanisterName: ".", AdminToken: "secret"}, &models.Engine{})
+	handler, _ := o.AdminHandler()
+
+	recorder := adminRequest(t, handler, "PUT", "/keys/a", `{"key": "a", "summarizer": "nonexistent", "endpoints": []}`)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "unknown summarizer") {
+		t.Errorf("Expected an unknown summarizer error, got %d %s", recorder.Code, recorder.Body)
+	}
+	recorder = adminRequest(t, handler, "PUT", "/keys/a", `{"key": "b", "derived": {"expressions": {"v": "1"}}}`)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "does not match") {
+		t.Errorf("Expected a key mismatch error, got %d %s", recorder.Code, recorder.Body)
+	}
+}
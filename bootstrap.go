@@ -0,0 +1,365 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BootstrapStep identifies a step of Oracle.Bootstrap
+type BootstrapStep string
+
+// The steps of Oracle.Bootstrap, in the order they run
+const (
+	StepCreateProject        BootstrapStep = "create-project"
+	StepUpdateCanisterCode   BootstrapStep = "update-canister-code"
+	StepStartNetwork         BootstrapStep = "start-network"
+	StepCreateWriterIdentity BootstrapStep = "create-writer-identity"
+	StepCreateCanister       BootstrapStep = "create-canister"
+	StepBuildCanister        BootstrapStep = "build-canister"
+	StepInstallCanister      BootstrapStep = "install-canister"
+	StepStartCanister        BootstrapStep = "start-canister"
+	StepAssignOwnerRole      BootstrapStep = "assign-owner-role"
+	StepAssignWriterRole     BootstrapStep = "assign-writer-role"
+)
+
+// BootstrapError is returned by Oracle.Bootstrap when one of its steps fails
+type BootstrapError struct {
+	Step BootstrapStep
+	Err  error
+}
+
+func (e *BootstrapError) Error() string {
+	return fmt.Sprintf("Bootstrap step %s failed: %v", e.Step, e.Err)
+}
+
+func (e *BootstrapError) Unwrap() error {
+	return e.Err
+}
+
+// PlannedStep is a step that Oracle.Bootstrap would run, as reported by Oracle.Plan
+type PlannedStep struct {
+	Step        BootstrapStep
+	Description string
+	// Conditional steps first check whether they are needed (e.g. whether the canister already exists), and do
+	// nothing if they aren't. Plan leaves out steps it found not to be needed, so this is only set for steps it
+	// couldn't check, e.g. because the network isn't running yet.
+	Conditional bool
+}
+
+// bootstrapStateFile is the file in the project directory that records the progress of Bootstrap, so that a later
+// process can resume from a failed step
+const bootstrapStateFile = ".oracle-bootstrap.json"
+
+// bootstrapState records the progress of Oracle.Bootstrap, so that it can resume from a failed step
+type bootstrapState struct {
+	mu              sync.Mutex // guards the fields below, which the HTTP endpoints read while Bootstrap runs
+	completed       map[BootstrapStep]bool
+	canisterExisted bool // whether the canister existed before bootstrapping, in which case it is upgraded
+	finished        bool // whether a call to Bootstrap has completed every step
+	// path is the file the progress is persisted to, and target identifies the network and canister it applies to
+	path   string
+	target string
+}
+
+// bootstrapProgress is the format of bootstrapStateFile
+type bootstrapProgress struct {
+	Target          string          `json:"target"`
+	Completed       []BootstrapStep `json:"completed"`
+	CanisterExisted bool            `json:"canister_existed"`
+}
+
+// load restores the progress persisted by a previous process that bootstrapped the same network and canister
+func (b *bootstrapState) load() error {
+	data, err := ioutil.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var progress bootstrapProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return fmt.Errorf("Could not parse %s: %w", b.path, err)
+	}
+	if progress.Target != b.target {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.completed = make(map[BootstrapStep]bool)
+	for _, step := range progress.Completed {
+		b.completed[step] = true
+	}
+	b.canisterExisted = progress.CanisterExisted
+	return nil
+}
+
+// save persists the progress, or removes the file once every step has completed, so that the next bootstrap runs
+// every step again
+func (b *bootstrapState) save() error {
+	b.mu.Lock()
+	progress := bootstrapProgress{Target: b.target, CanisterExisted: b.canisterExisted}
+	for _, step := range bootstrapSteps {
+		if b.completed[step.Step] {
+			progress.Completed = append(progress.Completed, step.Step)
+		}
+	}
+	b.mu.Unlock()
+	if len(progress.Completed) == len(bootstrapSteps) {
+		if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.path, append(data, '\n'), 0644)
+}
+
+func (b *bootstrapState) isCompleted(step BootstrapStep) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.completed[step]
+}
+
+func (b *bootstrapState) markCompleted(step BootstrapStep) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.completed == nil {
+		b.completed = make(map[BootstrapStep]bool)
+	}
+	b.completed[step] = true
+}
+
+func (b *bootstrapState) setCanisterExisted(existed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.canisterExisted = existed
+}
+
+func (b *bootstrapState) didCanisterExist() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.canisterExisted
+}
+
+// begin records that Bootstrap is running, keeping the progress of a previous call that it resumes
+func (b *bootstrapState) begin() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.completed == nil {
+		b.completed = make(map[BootstrapStep]bool)
+	}
+}
+
+// finish records that every step has completed, and resets the progress so that the next call to Bootstrap runs every
+// step again, like a new process would
+func (b *bootstrapState) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.completed = nil
+	b.canisterExisted = false
+	b.finished = true
+}
+
+// incomplete returns whether Bootstrap has been called without completing every step, i.e. is in progress or failed
+func (b *bootstrapState) incomplete() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.completed != nil
+}
+
+// started returns whether Bootstrap has been called, by this process or by a previous one it resumes
+func (b *bootstrapState) started() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.completed != nil || b.finished
+}
+
+type bootstrapStep struct {
+	PlannedStep
+	// check, if set, returns whether a conditional step has anything to do, for Plan; it may only query the state
+	check func(o *Oracle, facts *planFacts) (bool, error)
+	run   func(o *Oracle) error
+}
+
+// planFacts are what Plan has found out so far, for the checks of later steps
+type planFacts struct {
+	networkRunning bool
+	canisterExists *bool // nil if it couldn't be checked
+}
+
+// errNetworkNotRunning is returned by the checks of steps that need the network while it isn't running
+var errNetworkNotRunning = fmt.Errorf("The network is not running")
+
+// whenCanisterExists returns a check that runs the given check if the canister exists, and otherwise returns whether
+// a new canister needs the step
+func whenCanisterExists(neededForNewCanister bool, check func(o *Oracle) (bool, error)) func(o *Oracle, facts *planFacts) (bool, error) {
+	return func(o *Oracle, facts *planFacts) (bool, error) {
+		switch {
+		case !facts.networkRunning:
+			return false, errNetworkNotRunning
+		case facts.canisterExists == nil:
+			return false, fmt.Errorf("Could not determine whether the canister exists")
+		case !*facts.canisterExists:
+			return neededForNewCanister, nil
+		}
+		return check(o)
+	}
+}
+
+var bootstrapSteps = []bootstrapStep{
+	{PlannedStep{StepCreateProject, "write dfx.json into the project directory", false}, nil, func(o *Oracle) error {
+		return o.dfxService.writeDfxProject()
+	}},
+	{PlannedStep{StepUpdateCanisterCode, "write the canister source code", false}, nil, func(o *Oracle) error {
+		return o.dfxService.updateCanisterCode()
+	}},
+	{PlannedStep{StepStartNetwork, "start the local network and wait until it is ready, unless it is already running", true}, func(o *Oracle, facts *planFacts) (bool, error) {
+		facts.networkRunning = o.dfxService.isReplicaHealthy()
+		return !facts.networkRunning, nil
+	}, func(o *Oracle) error {
+		return o.dfxService.startDfxNetworkIfNeeded()
+	}},
+	{PlannedStep{StepCreateWriterIdentity, "create the writer identity if it doesn't exist", true}, func(o *Oracle, facts *planFacts) (bool, error) {
+		exists, err := o.dfxService.identityExists(o.dfxService.currentWriterIdentity())
+		return !exists, err
+	}, func(o *Oracle) error {
+		return o.dfxService.createWriterIdentityIfNeeded()
+	}},
+	{PlannedStep{StepCreateCanister, "create the canister if it doesn't exist", true}, func(o *Oracle, facts *planFacts) (bool, error) {
+		if !facts.networkRunning {
+			return false, errNetworkNotRunning
+		}
+		exists, err := o.dfxService.doesCanisterExist()
+		if err != nil {
+			return false, err
+		}
+		facts.canisterExists = &exists
+		return !exists, nil
+	}, func(o *Oracle) error {
+		exists, err := o.dfxService.doesCanisterExist()
+		if err != nil {
+			return err
+		}
+		o.bootstrap.setCanisterExisted(exists)
+		if exists {
+			return nil
+		}
+		return o.dfxService.createCanister()
+	}},
+	{PlannedStep{StepBuildCanister, "build the canister", false}, nil, func(o *Oracle) error {
+		return o.dfxService.buildCanister()
+	}},
+	{PlannedStep{StepInstallCanister, "install the canister, or upgrade it if it already existed", false}, nil, func(o *Oracle) error {
+		return o.dfxService.installCanister(o.bootstrap.didCanisterExist())
+	}},
+	// a newly installed canister is running, and its owner role hasn't been claimed
+	{PlannedStep{StepStartCanister, "start the canister if it isn't running", true}, whenCanisterExists(false, func(o *Oracle) (bool, error) {
+		running, err := o.dfxService.isCanisterRunning()
+		return !running, err
+	}), func(o *Oracle) error {
+		running, err := o.dfxService.isCanisterRunning()
+		if err != nil || running {
+			return err
+		}
+		return o.dfxService.startCanister()
+	}},
+	{PlannedStep{StepAssignOwnerRole, "claim the owner role if it hasn't been claimed", true}, whenCanisterExists(true, func(o *Oracle) (bool, error) {
+		isOwner, err := o.dfxService.checkIsOwner()
+		return !isOwner, err
+	}), func(o *Oracle) error {
+		isOwner, err := o.dfxService.checkIsOwner()
+		if err != nil || isOwner {
+			return err
+		}
+		return o.dfxService.assignOwnerRole()
+	}},
+	{PlannedStep{StepAssignWriterRole, "assign the writer role to the writer identity", false}, nil, func(o *Oracle) error {
+		writerPrincipal, err := o.dfxService.getWriterIDPrincipal()
+		if err != nil {
+			return err
+		}
+		return o.dfxService.assignWriterRole(writerPrincipal)
+	}},
+}
+
+// Bootstrap bootstraps the canister installation. If a step fails, Bootstrap returns a *BootstrapError identifying it,
+// and calling Bootstrap again resumes from that step, even from another process: the progress is kept in a file in
+// the project directory until every step has completed. Once every step has completed, calling Bootstrap again runs
+// every step again.
+func (o *Oracle) Bootstrap() error {
+	o.bootstrap.begin()
+	for _, step := range bootstrapSteps {
+		if o.bootstrap.isCompleted(step.Step) {
+			o.log.Infof("Skipping bootstrap step %s, which already completed", step.Step)
+			continue
+		}
+		if err := step.run(o); err != nil {
+			return &BootstrapError{Step: step.Step, Err: err}
+		}
+		o.bootstrap.markCompleted(step.Step)
+		if err := o.bootstrap.save(); err != nil {
+			o.log.WithError(err).Warnln("Could not save bootstrap progress")
+		}
+	}
+	o.bootstrap.finish()
+	return nil
+}
+
+// Plan returns the steps that Bootstrap would run, without running any of them. Steps that already completed in a
+// previous call to Bootstrap are left out, and so are conditional steps that Plan checked and found not to be needed.
+// Checking them only queries DFX, e.g. whether the network is running and whether the canister exists.
+func (o *Oracle) Plan() []PlannedStep {
+	var plan []PlannedStep
+	facts := &planFacts{}
+	for _, step := range bootstrapSteps {
+		if o.bootstrap.isCompleted(step.Step) {
+			switch step.Step {
+			case StepStartNetwork:
+				facts.networkRunning = o.dfxService.isReplicaHealthy()
+			case StepCreateCanister:
+				existed := o.bootstrap.didCanisterExist()
+				facts.canisterExists = &existed
+			}
+			continue
+		}
+		planned := step.PlannedStep
+		if step.check != nil {
+			needed, err := step.check(o, facts)
+			if err == nil && !needed {
+				continue
+			}
+			planned.Conditional = err != nil
+		}
+		if step.Step == StepInstallCanister && facts.canisterExists != nil {
+			planned.Description = "install the canister"
+			if *facts.canisterExists {
+				planned.Description = "upgrade the existing canister"
+			}
+		}
+		plan = append(plan, planned)
+	}
+	return plan
+}
+
+// CompletedBootstrapSteps returns the steps of Bootstrap that have completed, in order, in a call that is in progress or
+// failed; once a call completes every step, the progress is reset and it returns none
+func (o *Oracle) CompletedBootstrapSteps() []BootstrapStep {
+	var completed []BootstrapStep
+	for _, step := range bootstrapSteps {
+		if o.bootstrap.isCompleted(step.Step) {
+			completed = append(completed, step.Step)
+		}
+	}
+	return completed
+}
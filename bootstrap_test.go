@@ -0,0 +1,120 @@
+package framework
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestBootstrapReturnsStepErrors(t *testing.T) {
+	projectDir, err := ioutil.TempDir("", "oracle-project")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(projectDir)
+	emptyDir, err := ioutil.TempDir("", "no-dfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(emptyDir)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", emptyDir)
+	defer os.Setenv("PATH", path)
+
+	o := newTestOracle(t, &models.Config{CanisterName: "test", ProjectDir: projectDir}, &models.Engine{})
+	err = o.Bootstrap()
+
+	var bootstrapErr *BootstrapError
+	if !errors.As(err, &bootstrapErr) || bootstrapErr.Step != StepStartNetwork {
+		t.Fatalf("Expected the start network step to fail, got %v", err)
+	}
+	expected := []BootstrapStep{StepCreateProject, StepUpdateCanisterCode}
+	if !reflect.DeepEqual(o.CompletedBootstrapSteps(), expected) {
+		t.Errorf("Expected completed steps %v, got %v", expected, o.CompletedBootstrapSteps())
+	}
+	for _, file := range []string{"dfx.json", filepath.Join("src", "test", "main.mo"), filepath.Join("src", "test", "test.did")} {
+		if _, err := os.Stat(filepath.Join(projectDir, file)); err != nil {
+			t.Errorf("Expected %s to be written: %v", file, err)
+		}
+	}
+
+	// another process resumes, unless it bootstraps another network
+	resumed := newTestOracle(t, &models.Config{CanisterName: "test", ProjectDir: projectDir}, &models.Engine{})
+	if !reflect.DeepEqual(resumed.CompletedBootstrapSteps(), expected) {
+		t.Errorf("Expected a new oracle to resume after %v, got %v", expected, resumed.CompletedBootstrapSteps())
+	}
+	other := newTestOracle(t, &models.Config{CanisterName: "test", ProjectDir: projectDir, Network: "ic"}, &models.Engine{})
+	if completed := other.CompletedBootstrapSteps(); len(completed) != 0 {
+		t.Errorf("Expected bootstrapping another network to start over, got %v", completed)
+	}
+}
+
+func TestPlanChecksConditionalSteps(t *testing.T) {
+	// the network is running, the writer identity and canister exist, and the canister is running and owned
+	_, restore := fakeDfx(t, `case "$*" in
+"ping") exit 0 ;;
+"identity list") printf 'default\nwriter *\n' ;;
+"canister id test") echo "rrkah-fqaaa-aaaaa-aaaaq-cai" ;;
+"canister status test") echo "Canister test's status is Running." ;;
+"canister call test my_role") echo "(opt variant { owner })" ;;
+*) exit 1 ;;
+esac`)
+	defer restore()
+	o := newTestOracle(t, &models.Config{CanisterName: "test", ProjectDir: tempDir(t)}, &models.Engine{})
+
+	var steps []BootstrapStep
+	for _, step := range o.Plan() {
+		steps = append(steps, step.Step)
+		if step.Conditional {
+			t.Errorf("Expected every condition to be checked, got %+v", step)
+		}
+		if step.Step == StepInstallCanister && step.Description != "upgrade the existing canister" {
+			t.Errorf("Expected the existing canister to be upgraded, got %q", step.Description)
+		}
+	}
+	expected := []BootstrapStep{StepCreateProject, StepUpdateCanisterCode, StepBuildCanister, StepInstallCanister, StepAssignWriterRole}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Expected plan %v, got %v", expected, steps)
+	}
+}
+
+func TestPlanSkipsCompletedSteps(t *testing.T) {
+	o := newTestOracle(t, &models.Config{CanisterName: "test"}, &models.Engine{})
+	o.bootstrap.completed = map[BootstrapStep]bool{StepCreateProject: true, StepUpdateCanisterCode: true}
+
+	plan := o.Plan()
+
+	if len(plan) != len(bootstrapSteps)-2 || plan[0].Step != StepStartNetwork {
+		t.Errorf("Incorrect plan %v", plan)
+	}
+}
+
+func TestBootstrapRunsEveryStepAgainAfterCompleting(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls
+case "$*" in
+"canister status test") echo "Canister test's status is Running." ;;
+"canister call test my_role") echo "(opt variant { owner })" ;;
+esac`)
+	defer restore()
+	o := newTestOracle(t, &models.Config{CanisterName: "test", ProjectDir: tempDir(t)}, &models.Engine{})
+
+	for i := 0; i < 2; i++ {
+		if err := o.Bootstrap(); err != nil {
+			t.Fatalf("Could not bootstrap: %v", err)
+		}
+	}
+
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	if count := strings.Count(string(calls), "build test\n"); count != 2 {
+		t.Errorf("Expected the canister to be built by both calls, got %d builds:\n%s", count, calls)
+	}
+	if o.bootstrap.incomplete() || !o.bootstrap.started() || len(o.CompletedBootstrapSteps()) != 0 {
+		t.Errorf("Expected the progress to be reset after completing every step, got %v", o.CompletedBootstrapSteps())
+	}
+}
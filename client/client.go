@@ -0,0 +1,193 @@
+// Package client reads values from an oracle canister generated by the framework, calling its Candid interface through
+// the DFX command line tool.
+package client
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+)
+
+// Role is a role that a principal can have in the oracle canister
+type Role string
+
+// Roles in the oracle canister; RoleNone is returned for principals without a role
+const (
+	RoleNone   Role = ""
+	RoleOwner  Role = "owner"
+	RoleWriter Role = "writer"
+)
+
+// Config configures a Client
+type Config struct {
+	// Canister is the name or ID of the oracle canister
+	Canister string
+	// Network is the network the canister is deployed to, defaults to the local network
+	Network string
+	// Identity is the DFX identity used for calls, defaults to the currently selected identity
+	Identity string
+	// ProjectDir is the directory DFX is run in, which must contain the canister's dfx.json if Canister is a name
+	// rather than an ID
+	ProjectDir string
+}
+
+// Client reads values from an oracle canister
+type Client struct {
+	config Config
+}
+
+// New creates a new client for the configured canister
+func New(config Config) *Client {
+	return &Client{config: config}
+}
+
+// GetMapFieldValue returns the value of a field of the given key, and whether the field exists
+func (c *Client) GetMapFieldValue(ctx context.Context, key string, field string) (float64, bool, error) {
+	values, err := c.call(ctx, "get_map_field_value", utils.CandidText(key), utils.CandidText(field))
+	if err != nil {
+		return 0, false, err
+	}
+	opt, ok := values[0].(utils.CandidOpt)
+	if !ok {
+		return 0, false, nil
+	}
+	value, ok := opt.Value.(float64)
+	if !ok {
+		return 0, false, fmt.Errorf("Unexpected field value %v", opt.Value)
+	}
+	return value, true, nil
+}
+
+// GetMapValue returns the fields of the given key, and whether the key exists
+func (c *Client) GetMapValue(ctx context.Context, key string) (map[string]float64, bool, error) {
+	values, err := c.call(ctx, "get_map_value", utils.CandidText(key))
+	if err != nil {
+		return nil, false, err
+	}
+	opt, ok := values[0].(utils.CandidOpt)
+	if !ok {
+		return nil, false, nil
+	}
+	fields, err := decodeFields(opt.Value)
+	if err != nil {
+		return nil, false, err
+	}
+	return fields, true, nil
+}
+
+// GetMap returns the fields of every key in the canister
+func (c *Client) GetMap(ctx context.Context) (map[string]map[string]float64, error) {
+	values, err := c.call(ctx, "get_map")
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]map[string]float64)
+	err = decodeAssocList(values[0], func(key string, value interface{}) error {
+		fields, err := decodeFields(value)
+		if err != nil {
+			return err
+		}
+		result[key] = fields
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MyRole returns the role of the identity the client calls the canister as
+func (c *Client) MyRole(ctx context.Context) (Role, error) {
+	values, err := c.call(ctx, "my_role")
+	if err != nil {
+		return RoleNone, err
+	}
+	opt, ok := values[0].(utils.CandidOpt)
+	if !ok {
+		return RoleNone, nil
+	}
+	variant, ok := opt.Value.(utils.CandidVariant)
+	if !ok {
+		return RoleNone, fmt.Errorf("Unexpected role %v", opt.Value)
+	}
+	return Role(variant.Name), nil
+}
+
+// call calls the given canister method with the given serialized Candid arguments, and returns the parsed result
+func (c *Client) call(ctx context.Context, method string, args ...string) ([]interface{}, error) {
+	dfxArgs := []string{"canister"}
+	if c.config.Identity != "" {
+		dfxArgs = append([]string{"--identity", c.config.Identity}, dfxArgs...)
+	}
+	if c.config.Network != "" {
+		dfxArgs = append(dfxArgs, "--network", c.config.Network)
+	}
+	dfxArgs = append(dfxArgs, "call", c.config.Canister, method, "("+strings.Join(args, ", ")+")")
+
+	command := exec.CommandContext(ctx, "dfx", dfxArgs...)
+	command.Dir = c.config.ProjectDir
+	output, err := command.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("Could not call %s: %w: %s", method, err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("Could not call %s: %w", method, err)
+	}
+
+	values, err := utils.ParseCandid(string(output))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse %s result: %w", method, err)
+	}
+	if len(values) != 1 {
+		return nil, fmt.Errorf("Expected 1 result from %s, got %d", method, len(values))
+	}
+	return values, nil
+}
+
+// decodeFields decodes a Motoko AssocList<Text, Float>
+func decodeFields(list interface{}) (map[string]float64, error) {
+	result := make(map[string]float64)
+	err := decodeAssocList(list, func(field string, value interface{}) error {
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("Unexpected value %v for field %s", value, field)
+		}
+		result[field] = number
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decodeAssocList walks a Motoko AssocList<Text, V>, which Candid represents as nested optional records of the form
+// `opt record { record { key; value }; rest }`
+func decodeAssocList(list interface{}, entry func(key string, value interface{}) error) error {
+	for list != nil {
+		opt, ok := list.(utils.CandidOpt)
+		if !ok {
+			return fmt.Errorf("Unexpected list %v", list)
+		}
+		cell, ok := opt.Value.(utils.CandidRecord)
+		if !ok || len(cell) != 2 {
+			return fmt.Errorf("Unexpected list cell %v", opt.Value)
+		}
+		pair, ok := cell[0].Value.(utils.CandidRecord)
+		if !ok || len(pair) != 2 {
+			return fmt.Errorf("Unexpected list entry %v", cell[0].Value)
+		}
+		key, ok := pair[0].Value.(string)
+		if !ok {
+			return fmt.Errorf("Unexpected list key %v", pair[0].Value)
+		}
+		if err := entry(key, pair[1].Value); err != nil {
+			return err
+		}
+		list = cell[1].Value
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDfx puts a DFX executable that prints the output for the called method first on the PATH, recording its
+// arguments in the returned file
+func fakeDfx(t *testing.T, outputs map[string]string) string {
+	dir := tempDir(t)
+	script := "#!/bin/sh\necho \"$@\" >> " + filepath.Join(dir, "calls") + "\nfor arg; do case \"$arg\" in\n"
+	for method, output := range outputs {
+		script += method + ") cat <<'EOF'\n" + output + "\nEOF\nexit 0 ;;\n"
+	}
+	script += "esac; done\necho 'no such method' >&2\nexit 1\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "dfx"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	t.Cleanup(func() { os.Setenv("PATH", path) })
+	return filepath.Join(dir, "calls")
+}
+
+func TestClient(t *testing.T) {
+	calls := fakeDfx(t, map[string]string{
+		"get_map_field_value": "(opt (21.5 : float64))",
+		"get_map_value":       `(opt opt record { record { "temperature"; 21.5 : float64 }; opt record { record { "humidity"; 40 : float64 }; null } })`,
+		"get_map":             `(opt record { record { "Tokyo"; opt record { record { "temperature"; 21.5 : float64 }; null } }; null })`,
+		"my_role":             "(opt variant { writer })",
+	})
+	c := New(Config{Canister: "weather_oracle", Network: "ic", Identity: "reader"})
+	ctx := context.Background()
+
+	value, ok, err := c.GetMapFieldValue(ctx, "Tokyo", "temperature")
+	if err != nil || !ok || value != 21.5 {
+		t.Errorf("Incorrect field value %v, %v, %v", value, ok, err)
+	}
+	fields, ok, err := c.GetMapValue(ctx, "Tokyo")
+	if err != nil || !ok || !reflect.DeepEqual(fields, map[string]float64{"temperature": 21.5, "humidity": 40}) {
+		t.Errorf("Incorrect map value %v, %v, %v", fields, ok, err)
+	}
+	all, err := c.GetMap(ctx)
+	if err != nil || !reflect.DeepEqual(all, map[string]map[string]float64{"Tokyo": {"temperature": 21.5}}) {
+		t.Errorf("Incorrect map %v, %v", all, err)
+	}
+	role, err := c.MyRole(ctx)
+	if err != nil || role != RoleWriter {
+		t.Errorf("Incorrect role %v, %v", role, err)
+	}
+
+	recorded, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `--identity reader canister --network ic call weather_oracle get_map_field_value ("Tokyo", "temperature")`
+	if !strings.HasPrefix(string(recorded), expected+"\n") {
+		t.Errorf("Incorrect DFX call %s", recorded)
+	}
+}
+
+func TestClientMissingValues(t *testing.T) {
+	fakeDfx(t, map[string]string{"get_map_field_value": "(null)", "my_role": "(null)"})
+	c := New(Config{Canister: "weather_oracle"})
+
+	if _, ok, err := c.GetMapFieldValue(context.Background(), "Tokyo", "temperature"); err != nil || ok {
+		t.Errorf("Expected missing field, got %v, %v", ok, err)
+	}
+	if role, err := c.MyRole(context.Background()); err != nil || role != RoleNone {
+		t.Errorf("Expected no role, got %v, %v", role, err)
+	}
+	if _, err := c.GetMap(context.Background()); err == nil || !strings.Contains(err.Error(), "no such method") {
+		t.Errorf("Expected DFX error, got %v", err)
+	}
+}
+
+// tempDir creates a temporary directory that is removed when the test ends
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oracle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,266 @@
+// Command oracle operates an oracle described by a declarative configuration file (see the config package), using
+// the same Oracle and DFXService that embedding applications use. Run it without arguments for the list of commands.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	framework "github.com/hyplabs/dfinity-oracle-framework"
+	"github.com/hyplabs/dfinity-oracle-framework/config"
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+const usage = `Usage: oracle [-config oracle.yaml] [-network name] <command> [arguments]
+
+Commands:
+  bootstrap [-dry-run]        create, build, install and configure the oracle canister
+  run [-watch]                publish values at the configured interval until stopped, reloading the
+                              configuration on SIGHUP, or whenever it changes with -watch
+  once                        publish values for every key once
+  status                      show the canister status and the current identity's role
+  read <key> [field]          read a key, or a single field of a key, from the canister
+  writers add <principal>     assign the writer role to a principal
+  writers revoke [-confirm-mainnet] <principal>
+                              revoke the writer role from a principal
+  writers rotate [-confirm-mainnet] <identity>
+                              make a new DFX identity the writer and revoke the previous writer
+  writers list                list principals with roles in the canister
+  self-destruct [-yes] [-confirm-mainnet]
+                              permanently disable the canister, after confirmation
+
+Options:
+`
+
+func main() {
+	flags := flag.NewFlagSet("oracle", flag.ExitOnError)
+	configPath := flags.String("config", "oracle.yaml", "path to the oracle configuration file (.yaml, .yml, .json or .toml)")
+	network := flags.String("network", "", "network to use, overriding the configuration file: local, ic, another network in dfx.json, or a provider URL")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	registry := config.NewRegistry()
+	cfg, engine, err := config.Load(*configPath, registry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *network != "" {
+		cfg.Network = *network
+	}
+	oracle, err := framework.NewOracle(cfg, engine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid oracle configuration:", err)
+		os.Exit(1)
+	}
+	oracle.SetRegistry(registry)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	reloader := &configReloader{path: *configPath, registry: registry, network: *network}
+	if err := runCommand(ctx, oracle, cfg, reloader, flags.Args(), os.Stdin, os.Stdout); err != nil {
+		if err == errUsage {
+			flags.Usage()
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+var errUsage = fmt.Errorf("invalid usage")
+
+// configReloader reloads the configuration file into a running oracle
+type configReloader struct {
+	path     string
+	registry *config.Registry
+	network  string // overrides the network of the reloaded configuration, like the -network option
+}
+
+// start reloads the configuration whenever the process receives SIGHUP, and if watch is set, whenever the file
+// changes, until the given context is cancelled
+func (r *configReloader) start(ctx context.Context, oracle *framework.Oracle, watch bool) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangups)
+		for {
+			select {
+			case <-hangups:
+				r.reload(oracle)(config.Load(r.path, r.registry))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	if watch {
+		go config.Watch(ctx, r.path, r.registry, watchInterval, r.reload(oracle))
+	}
+}
+
+func (r *configReloader) reload(oracle *framework.Oracle) config.ReloadFunc {
+	return func(cfg *models.Config, engine *models.Engine, err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not reload configuration, keeping the current one:", err)
+			return
+		}
+		if r.network != "" {
+			cfg.Network = r.network
+		}
+		// Reload logs the outcome itself
+		oracle.Reload(cfg, engine)
+	}
+}
+
+// watchInterval is how often `run -watch` checks the configuration file for changes
+const watchInterval = 2 * time.Second
+
+func runCommand(ctx context.Context, oracle *framework.Oracle, cfg *models.Config, reloader *configReloader, args []string, in io.Reader, out io.Writer) error {
+	switch args[0] {
+	case "bootstrap":
+		flags := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+		dryRun := flags.Bool("dry-run", false, "print the steps that would run without running them")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 {
+			return errUsage
+		}
+		if *dryRun {
+			for _, step := range oracle.Plan() {
+				conditional := ""
+				if step.Conditional {
+					conditional = " (if needed)"
+				}
+				fmt.Fprintf(out, "%-24s %s%s\n", step.Step, step.Description, conditional)
+			}
+			return nil
+		}
+		return oracle.Bootstrap()
+	case "run":
+		flags := flag.NewFlagSet("run", flag.ContinueOnError)
+		watch := flags.Bool("watch", false, "reload the configuration whenever the file changes")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 0 {
+			return errUsage
+		}
+		reloader.start(ctx, oracle, *watch)
+		return oracle.Run(ctx)
+	case "once":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return oracle.RunOnce(ctx)
+	case "status":
+		if len(args) != 1 {
+			return errUsage
+		}
+		status, err := oracle.Status()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\nRole: %s\n", status.Status, status.Role)
+		return nil
+	case "read":
+		var value string
+		var err error
+		switch len(args) {
+		case 2:
+			value, err = oracle.ReadValue(args[1])
+		case 3:
+			value, err = oracle.ReadFieldValue(args[1], args[2])
+		default:
+			return errUsage
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, value)
+		return nil
+	case "writers":
+		return runWritersCommand(oracle, args[1:], out)
+	case "self-destruct":
+		return runSelfDestructCommand(oracle, cfg, args[1:], in, out)
+	}
+	return errUsage
+}
+
+func runWritersCommand(oracle *framework.Oracle, args []string, out io.Writer) error {
+	switch {
+	case len(args) == 2 && args[0] == "add":
+		return oracle.AddWriter(args[1])
+	case len(args) >= 2 && args[0] == "revoke":
+		flags := flag.NewFlagSet("writers revoke", flag.ContinueOnError)
+		confirmMainnet := flags.Bool("confirm-mainnet", false, "allow revoking writers on mainnet")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+			return errUsage
+		}
+		return oracle.RevokeWriter(flags.Arg(0), destructiveOptions(*confirmMainnet)...)
+	case len(args) >= 2 && args[0] == "rotate":
+		flags := flag.NewFlagSet("writers rotate", flag.ContinueOnError)
+		confirmMainnet := flags.Bool("confirm-mainnet", false, "allow revoking the previous writer on mainnet")
+		if err := flags.Parse(args[1:]); err != nil || flags.NArg() != 1 {
+			return errUsage
+		}
+		return oracle.RotateWriter(flags.Arg(0), destructiveOptions(*confirmMainnet)...)
+	case len(args) == 1 && args[0] == "list":
+		roles, err := oracle.ListRoles()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, roles)
+		return nil
+	}
+	return errUsage
+}
+
+func runSelfDestructCommand(oracle *framework.Oracle, cfg *models.Config, args []string, in io.Reader, out io.Writer) error {
+	flags := flag.NewFlagSet("self-destruct", flag.ContinueOnError)
+	yes := flags.Bool("yes", false, "skip the confirmation prompt")
+	confirmMainnet := flags.Bool("confirm-mainnet", false, "allow self-destructing a canister on mainnet")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+	canisterName := cfg.CanisterName
+
+	if !*yes {
+		network := cfg.Network
+		if network == "" {
+			network = "local"
+		}
+		fmt.Fprintf(out, "This permanently disables the %s canister on the %s network and deletes all of its data.\nType the canister name to confirm: ", canisterName, network)
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if strings.TrimSpace(answer) != canisterName {
+			return fmt.Errorf("Confirmation did not match the canister name, not self-destructing")
+		}
+	}
+	return oracle.SelfDestruct(destructiveOptions(*confirmMainnet)...)
+}
+
+// destructiveOptions returns the options of a destructive operation given the -confirm-mainnet flag
+func destructiveOptions(confirmMainnet bool) []framework.DestructiveOption {
+	if confirmMainnet {
+		return []framework.DestructiveOption{framework.ConfirmMainnet()}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	framework "github.com/hyplabs/dfinity-oracle-framework"
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// fakeDfx puts a fake dfx executable running the given shell script first in PATH, returning the directory it runs in
+// and a function that restores PATH and removes the directory
+func fakeDfx(t *testing.T, body string) (string, func()) {
+	dir, err := ioutil.TempDir("", "fake-dfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncd " + dir + "\n" + body + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "dfx"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return dir, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+// newTestOracle creates an oracle for a canister whose project is in the given directory
+func newTestOracle(t *testing.T, dir string, network string) (*framework.Oracle, *models.Config) {
+	cfg := &models.Config{CanisterName: "test_oracle", ProjectDir: dir, Network: network, UpdateInterval: time.Minute}
+	oracle, err := framework.NewOracle(cfg, &models.Engine{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oracle, cfg
+}
+
+// dfxCalls returns the arguments of every call to the fake dfx, one call per line
+func dfxCalls(dir string) string {
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	return string(calls)
+}
+
+func TestRunCommandRejectsInvalidUsage(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls`)
+	defer restore()
+	oracle, cfg := newTestOracle(t, dir, "")
+
+	for _, args := range [][]string{
+		{"unknown"},
+		{"bootstrap", "-unknown"},
+		{"bootstrap", "extra"},
+		{"run", "-watch=maybe"},
+		{"run", "extra"},
+		{"once", "extra"},
+		{"status", "extra"},
+		{"read"},
+		{"read", "key", "field", "extra"},
+		{"writers"},
+		{"writers", "add"},
+		{"writers", "revoke"},
+		{"writers", "revoke", "-confirm-mainnet"},
+		{"writers", "rotate", "writer-2", "extra"},
+		{"writers", "list", "extra"},
+		{"self-destruct", "-force"},
+		{"self-destruct", "-yes", "extra"},
+	} {
+		var out bytes.Buffer
+		if err := runCommand(context.Background(), oracle, cfg, &configReloader{}, args, strings.NewReader(""), &out); err != errUsage {
+			t.Errorf("Expected a usage error for %q, got %v", args, err)
+		}
+	}
+	if calls := dfxCalls(dir); calls != "" {
+		t.Errorf("Expected no DFX calls for invalid usage, got:\n%s", calls)
+	}
+}
+
+func TestSelfDestructRequiresConfirmation(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls`)
+	defer restore()
+	oracle, cfg := newTestOracle(t, dir, "")
+
+	var out bytes.Buffer
+	err := runCommand(context.Background(), oracle, cfg, &configReloader{}, []string{"self-destruct"}, strings.NewReader("other_oracle\n"), &out)
+	if err == nil || !strings.Contains(out.String(), "Type the canister name to confirm") {
+		t.Errorf("Expected a mismatched confirmation to be rejected, got %v with output %q", err, out.String())
+	}
+	if calls := dfxCalls(dir); calls != "" {
+		t.Errorf("Expected no DFX calls without confirmation, got:\n%s", calls)
+	}
+
+	for _, command := range []struct {
+		args  []string
+		input string
+	}{
+		{[]string{"self-destruct"}, "test_oracle\n"},
+		{[]string{"self-destruct", "-yes"}, ""},
+	} {
+		os.Remove(filepath.Join(dir, "calls"))
+		if err := runCommand(context.Background(), oracle, cfg, &configReloader{}, command.args, strings.NewReader(command.input), &out); err != nil {
+			t.Errorf("Expected %q to self-destruct, got %v", command.args, err)
+		}
+		if calls := dfxCalls(dir); !strings.Contains(calls, "canister call test_oracle self_destruct") {
+			t.Errorf("Expected %q to self-destruct the canister, got:\n%s", command.args, calls)
+		}
+	}
+}
+
+func TestDestructiveCommandsRequireConfirmMainnet(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls
+case "$*" in
+*get-principal*) echo "principal-$2" ;;
+esac`)
+	defer restore()
+
+	for _, command := range []struct {
+		args      []string
+		confirmed []string
+	}{
+		{[]string{"self-destruct", "-yes"}, []string{"self-destruct", "-yes", "-confirm-mainnet"}},
+		{[]string{"writers", "revoke", "aaaaa-aa"}, []string{"writers", "revoke", "-confirm-mainnet", "aaaaa-aa"}},
+		{[]string{"writers", "rotate", "writer-2"}, []string{"writers", "rotate", "-confirm-mainnet", "writer-2"}},
+	} {
+		oracle, cfg := newTestOracle(t, dir, "ic")
+		os.Remove(filepath.Join(dir, "calls"))
+		var out bytes.Buffer
+		if err := runCommand(context.Background(), oracle, cfg, &configReloader{}, command.args, strings.NewReader(""), &out); err != framework.ErrMainnetConfirmationRequired {
+			t.Errorf("Expected %q to require -confirm-mainnet, got %v", command.args, err)
+		}
+		if calls := dfxCalls(dir); calls != "" {
+			t.Errorf("Expected no DFX calls for %q without -confirm-mainnet, got:\n%s", command.args, calls)
+		}
+
+		if err := runCommand(context.Background(), oracle, cfg, &configReloader{}, command.confirmed, strings.NewReader(""), &out); err != nil {
+			t.Errorf("Expected %q to succeed, got %v", command.confirmed, err)
+		}
+		if calls := dfxCalls(dir); !strings.Contains(calls, "--network ic") {
+			t.Errorf("Expected %q to call DFX on mainnet, got:\n%s", command.confirmed, calls)
+		}
+		if cfg.AllowMainnetDestructiveOperations {
+			t.Errorf("Expected %q not to allow later destructive operations", command.confirmed)
+		}
+	}
+}
+
+func TestOnceReportsFailedKeys(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls`)
+	defer restore()
+	cfg := &models.Config{CanisterName: "test_oracle", ProjectDir: dir, UpdateInterval: time.Minute}
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "unreachable", Endpoints: []models.Endpoint{{Endpoint: "http://127.0.0.1:0", JSONPaths: map[string]string{"v": "$.v"}}}},
+	}}
+	oracle, err := framework.NewOracle(cfg, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runCommand(context.Background(), oracle, cfg, &configReloader{}, []string{"once"}, strings.NewReader(""), &out); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Errorf("Expected once to fail with the key that was not updated, got %v", err)
+	}
+}
+
+func TestBootstrapDryRunPrintsPlan(t *testing.T) {
+	// the local network isn't running, so every step would run
+	dir, restore := fakeDfx(t, `echo "$@" >> calls
+exit 1`)
+	defer restore()
+	oracle, cfg := newTestOracle(t, dir, "")
+
+	var out bytes.Buffer
+	if err := runCommand(context.Background(), oracle, cfg, &configReloader{}, []string{"bootstrap", "-dry-run"}, strings.NewReader(""), &out); err != nil {
+		t.Fatalf("Could not print the bootstrap plan: %v", err)
+	}
+
+	expected := `create-project           write dfx.json into the project directory
+update-canister-code     write the canister source code
+start-network            start the local network and wait until it is ready, unless it is already running
+create-writer-identity   create the writer identity if it doesn't exist (if needed)
+create-canister          create the canister if it doesn't exist (if needed)
+build-canister           build the canister
+install-canister         install the canister, or upgrade it if it already existed
+start-canister           start the canister if it isn't running (if needed)
+assign-owner-role        claim the owner role if it hasn't been claimed (if needed)
+assign-writer-role       assign the writer role to the writer identity
+`
+	if out.String() != expected {
+		t.Errorf("Incorrect plan, expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dfx.json")); err == nil {
+		t.Errorf("Expected a dry run not to write dfx.json")
+	}
+	for _, call := range strings.Split(strings.TrimSpace(dfxCalls(dir)), "\n") {
+		if !strings.HasPrefix(call, "ping") && !strings.HasPrefix(call, "identity list") {
+			t.Errorf("Expected a dry run to only check the network and identities, got call %q", call)
+		}
+	}
+}
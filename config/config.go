@@ -0,0 +1,785 @@
+// Package config loads oracles from declarative configuration files in YAML, JSON or TOML format.
+//
+// A configuration file describes the canister, the update interval and every key along with its endpoints, e.g.
+//
+//	canister_name: weather_oracle
+//	update_interval: 5m
+//	keys:
+//	  - key: Tokyo
+//	    summarizer: median_without_outliers
+//	    field_summarizers:
+//	      wind_gust_kph: max
+//	    endpoints:
+//	      - url: http://api.weatherapi.com/v1/current.json?key=API_KEY&q=Tokyo,JP
+//	        json_paths:
+//	          temperature_celsius: $.current.temp_c
+//	          wind_gust_kph: $.current.gust_kph
+//
+// Go functions, such as custom summarizers or normalization functions, are referred to by the names they were given in
+// a Registry.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hyplabs/dfinity-oracle-framework/expr"
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/schedule"
+	"github.com/hyplabs/dfinity-oracle-framework/summary"
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+	"github.com/oliveagle/jsonpath"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a configuration file format
+type Format string
+
+// Supported configuration file formats
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+	TOML Format = "toml"
+)
+
+// Error is a problem with a single value in a configuration file
+type Error struct {
+	File    string
+	Path    string // location of the value within the document, e.g. "keys[0].endpoints[1].url"
+	Line    int    // 1-based, or 0 if unknown
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		position := fmt.Sprintf("%d:%d", e.Line, e.Column)
+		if location == "" {
+			location = position
+		} else {
+			location += ":" + position
+		}
+	}
+	if e.Path != "" {
+		if location == "" {
+			location = e.Path
+		} else {
+			location += ": " + e.Path
+		}
+	}
+	if location == "" {
+		return e.Message
+	}
+	return location + ": " + e.Message
+}
+
+// Errors is every problem found in a configuration file
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d error(s) in configuration:\n%s", len(e), strings.Join(messages, "\n"))
+}
+
+// Load reads the configuration file at the given path, detecting its format from the file extension
+func Load(path string, registry *Registry) (*models.Config, *models.Engine, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not read configuration file: %w", err)
+	}
+	return parse(data, format, path, registry)
+}
+
+// Parse parses a configuration document in the given format
+func Parse(data []byte, format Format, registry *Registry) (*models.Config, *models.Engine, error) {
+	return parse(data, format, "", registry)
+}
+
+// FormatOf returns the configuration format corresponding to the extension of the given path
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".json":
+		return JSON, nil
+	case ".toml":
+		return TOML, nil
+	}
+	return "", fmt.Errorf("Unsupported configuration file extension %q, expected .yaml, .yml, .json or .toml", filepath.Ext(path))
+}
+
+func parse(data []byte, format Format, file string, registry *Registry) (*models.Config, *models.Engine, error) {
+	root, err := parseDocument(data, format, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := newDecoder(file, registry)
+	config, engine := d.decodeRoot(root)
+	if len(d.errs) > 0 {
+		return nil, nil, d.errs
+	}
+	return config, engine, nil
+}
+
+// ParseKey parses a single key in the given format, with the same fields as an entry of `keys` in a configuration file
+func ParseKey(data []byte, format Format, registry *Registry) (models.MappingMetadata, error) {
+	root, err := parseDocument(data, format, "")
+	if err != nil {
+		return models.MappingMetadata{}, err
+	}
+	d := newDecoder("", registry)
+	meta := d.decodeKey(root, "")
+	if len(d.errs) > 0 {
+		return models.MappingMetadata{}, d.errs
+	}
+	return meta, nil
+}
+
+// parseDocument parses a document in the given format into a node tree
+func parseDocument(data []byte, format Format, file string) (*node, error) {
+	switch format {
+	case YAML, JSON:
+		// JSON is a subset of YAML, so both are parsed by the YAML parser to keep track of line numbers
+		var document yaml.Node
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return nil, Errors{{File: file, Message: err.Error()}}
+		}
+		root, err := fromYAML(&document)
+		if err != nil {
+			return nil, Errors{{File: file, Message: err.Error()}}
+		}
+		return root, nil
+	case TOML:
+		var document map[string]interface{}
+		if _, err := toml.Decode(string(data), &document); err != nil {
+			return nil, Errors{{File: file, Message: err.Error()}}
+		}
+		return fromValue(document), nil
+	}
+	return nil, fmt.Errorf("Unsupported configuration format %q", format)
+}
+
+func newDecoder(file string, registry *Registry) *decoder {
+	if registry == nil {
+		registry = NewRegistry()
+	}
+	return &decoder{file: file, registry: registry}
+}
+
+// decoder converts a node tree into the oracle configuration, collecting every error rather than stopping at the first
+type decoder struct {
+	file         string
+	registry     *Registry
+	errs         Errors
+	dependencies []dependency
+}
+
+// dependency is a reference from a derived key to another key, checked once every key of the file has been decoded
+type dependency struct {
+	key       string
+	dependsOn string
+	n         *node
+	path      string
+}
+
+func (d *decoder) errorf(n *node, path string, format string, args ...interface{}) {
+	err := &Error{File: d.file, Path: path, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		err.Line, err.Column = n.line, n.column
+	}
+	d.errs = append(d.errs, err)
+}
+
+// fields checks that n is a mapping containing only the allowed keys, returning its fields
+func (d *decoder) fields(n *node, path string, allowed ...string) map[string]*node {
+	if n.kind != mappingNode {
+		d.errorf(n, path, "expected a mapping, got %s", n.kind)
+		return map[string]*node{}
+	}
+	for _, key := range n.keys {
+		known := false
+		for _, a := range allowed {
+			known = known || key == a
+		}
+		if !known {
+			d.errorf(n.fields[key], join(path, key), "unknown field %q, expected one of %s", key, strings.Join(allowed, ", "))
+		}
+	}
+	return n.fields
+}
+
+func (d *decoder) str(n *node, path string) string {
+	if n.kind != scalarNode {
+		d.errorf(n, path, "expected a string, got %s", n.kind)
+		return ""
+	}
+	return n.value
+}
+
+func (d *decoder) requiredStr(fields map[string]*node, parent *node, path string, key string) string {
+	n, ok := fields[key]
+	if !ok {
+		d.errorf(parent, path, "missing required field %q", key)
+		return ""
+	}
+	value := d.str(n, join(path, key))
+	if value == "" && n.kind == scalarNode {
+		d.errorf(n, join(path, key), "must not be empty")
+	}
+	return value
+}
+
+func (d *decoder) boolean(n *node, path string) bool {
+	value, err := strconv.ParseBool(n.value)
+	if n.kind != scalarNode || err != nil {
+		d.errorf(n, path, "expected true or false, got %q", n.value)
+	}
+	return value
+}
+
+func (d *decoder) integer(n *node, path string) int {
+	value, err := strconv.Atoi(n.value)
+	if n.kind != scalarNode || err != nil {
+		d.errorf(n, path, "expected an integer, got %q", n.value)
+	}
+	return value
+}
+
+func (d *decoder) positiveInteger(n *node, path string) int {
+	value, err := strconv.Atoi(n.value)
+	if n.kind != scalarNode || err != nil || value <= 0 {
+		d.errorf(n, path, "expected a positive integer, got %q", n.value)
+	}
+	return value
+}
+
+func (d *decoder) duration(n *node, path string) time.Duration {
+	value, err := time.ParseDuration(n.value)
+	if n.kind != scalarNode || err != nil || value <= 0 {
+		d.errorf(n, path, "expected a positive duration such as \"30s\" or \"5m\", got %q", n.value)
+	}
+	return value
+}
+
+func (d *decoder) strList(n *node, path string) []string {
+	if n.kind != sequenceNode {
+		d.errorf(n, path, "expected a list, got %s", n.kind)
+		return nil
+	}
+	result := make([]string, len(n.items))
+	for i, item := range n.items {
+		result[i] = d.str(item, index(path, i))
+	}
+	return result
+}
+
+func (d *decoder) strMap(n *node, path string) map[string]string {
+	if n.kind != mappingNode {
+		d.errorf(n, path, "expected a mapping, got %s", n.kind)
+		return nil
+	}
+	result := make(map[string]string)
+	for _, key := range n.keys {
+		result[key] = d.str(n.fields[key], join(path, key))
+	}
+	return result
+}
+
+func (d *decoder) decodeRoot(root *node) (*models.Config, *models.Engine) {
+	config := &models.Config{}
+	engine := &models.Engine{}
+	fields := d.fields(root, "", "canister_name", "update_interval", "history_size", "max_concurrent_keys", "max_concurrent_requests", "max_requests_per_host", "rate_limits", "quota_file", "transport", "shutdown_grace_period", "unmanaged_replica", "replica_ready_timeout", "http_address", "admin_address", "admin_token", "network", "owner_identity", "writer_identity", "writer_pem_file",
+		"project_dir", "canister_template", "networks", "canister_settings", "keys")
+
+	config.CanisterName = d.requiredStr(fields, root, "", "canister_name")
+	if n, ok := fields["update_interval"]; ok {
+		config.UpdateInterval = d.duration(n, "update_interval")
+	} else {
+		d.errorf(root, "", "missing required field %q", "update_interval")
+	}
+	if n, ok := fields["history_size"]; ok {
+		config.HistorySize = d.positiveInteger(n, "history_size")
+	}
+	if n, ok := fields["max_concurrent_keys"]; ok {
+		config.MaxConcurrentKeys = d.positiveInteger(n, "max_concurrent_keys")
+	}
+	if n, ok := fields["max_concurrent_requests"]; ok {
+		config.MaxConcurrentRequests = d.positiveInteger(n, "max_concurrent_requests")
+	}
+	if n, ok := fields["max_requests_per_host"]; ok {
+		config.MaxRequestsPerHost = d.positiveInteger(n, "max_requests_per_host")
+	}
+	if n, ok := fields["rate_limits"]; ok {
+		if n.kind != sequenceNode {
+			d.errorf(n, "rate_limits", "expected a list, got %s", n.kind)
+		}
+		for i, item := range n.items {
+			config.RateLimits = append(config.RateLimits, d.decodeRateLimit(item, index("rate_limits", i)))
+		}
+	}
+	if n, ok := fields["quota_file"]; ok {
+		config.QuotaFile = d.relativePath(d.str(n, "quota_file"))
+	}
+	if n, ok := fields["transport"]; ok {
+		config.Transport = d.decodeTransport(n, "transport")
+	}
+	if n, ok := fields["shutdown_grace_period"]; ok {
+		config.ShutdownGracePeriod = d.duration(n, "shutdown_grace_period")
+	}
+	if n, ok := fields["unmanaged_replica"]; ok {
+		config.UnmanagedReplica = d.boolean(n, "unmanaged_replica")
+	}
+	if n, ok := fields["replica_ready_timeout"]; ok {
+		config.ReplicaReadyTimeout = d.duration(n, "replica_ready_timeout")
+	}
+	if n, ok := fields["http_address"]; ok {
+		config.HTTPAddress = d.str(n, "http_address")
+	}
+	if n, ok := fields["admin_address"]; ok {
+		config.AdminAddress = d.str(n, "admin_address")
+	}
+	if n, ok := fields["admin_token"]; ok {
+		config.AdminToken = d.str(n, "admin_token")
+	}
+	if n, ok := fields["network"]; ok {
+		config.Network = d.str(n, "network")
+	}
+	if n, ok := fields["owner_identity"]; ok {
+		config.OwnerIdentity = d.str(n, "owner_identity")
+	}
+	if n, ok := fields["writer_identity"]; ok {
+		config.WriterIdentity = d.str(n, "writer_identity")
+	}
+	if n, ok := fields["writer_pem_file"]; ok {
+		config.WriterPEMFile = d.relativePath(d.str(n, "writer_pem_file"))
+	}
+	if n, ok := fields["project_dir"]; ok {
+		config.ProjectDir = d.relativePath(d.str(n, "project_dir"))
+	}
+	if n, ok := fields["canister_template"]; ok {
+		config.CanisterTemplateFile = d.relativePath(d.str(n, "canister_template"))
+	}
+	if n, ok := fields["networks"]; ok {
+		config.Networks = d.strMap(n, "networks")
+	}
+	if n, ok := fields["canister_settings"]; ok {
+		settings := d.fields(n, "canister_settings", "compute_allocation", "memory_allocation")
+		if c, ok := settings["compute_allocation"]; ok {
+			config.CanisterSettings.ComputeAllocation = d.integer(c, "canister_settings.compute_allocation")
+			if config.CanisterSettings.ComputeAllocation < 0 || config.CanisterSettings.ComputeAllocation > 100 {
+				d.errorf(c, "canister_settings.compute_allocation", "must be between 0 and 100")
+			}
+		}
+		if m, ok := settings["memory_allocation"]; ok {
+			config.CanisterSettings.MemoryAllocation = d.str(m, "canister_settings.memory_allocation")
+		}
+	}
+
+	keys, ok := fields["keys"]
+	if !ok || keys.kind != sequenceNode || len(keys.items) == 0 {
+		d.errorf(root, "keys", "expected a non-empty list of keys")
+		return config, engine
+	}
+	seen := make(map[string]string)
+	for i, item := range keys.items {
+		path := index("keys", i)
+		meta := d.decodeKey(item, path)
+		if previous, ok := seen[meta.Key]; ok && meta.Key != "" {
+			d.errorf(item, path, "duplicate key %q, already defined at %s", meta.Key, previous)
+		}
+		seen[meta.Key] = path
+		engine.Metadata = append(engine.Metadata, meta)
+	}
+	d.checkDependencies(seen)
+	return config, engine
+}
+
+// checkDependencies reports derived keys that depend on unknown keys, or on themselves through any number of keys
+func (d *decoder) checkDependencies(keys map[string]string) {
+	graph := make(map[string][]dependency)
+	reported := make(map[[2]string]bool)
+	for _, dep := range d.dependencies {
+		if reported[[2]string{dep.key, dep.dependsOn}] {
+			continue
+		}
+		reported[[2]string{dep.key, dep.dependsOn}] = true
+		if _, ok := keys[dep.dependsOn]; !ok {
+			d.errorf(dep.n, dep.path, "unknown key %q", dep.dependsOn)
+			continue
+		}
+		graph[dep.key] = append(graph[dep.key], dep)
+	}
+
+	// depth-first search, reporting each cycle at the reference that closes it
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(key string)
+	visit = func(key string) {
+		state[key] = visiting
+		path = append(path, key)
+		for _, dep := range graph[key] {
+			switch state[dep.dependsOn] {
+			case unvisited:
+				visit(dep.dependsOn)
+			case visiting:
+				start := 0
+				for path[start] != dep.dependsOn {
+					start++
+				}
+				cycle := append(append([]string{}, path[start:]...), dep.dependsOn)
+				d.errorf(dep.n, dep.path, "derived keys form a cycle: %s", strings.Join(cycle, " -> "))
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = visited
+	}
+	for _, dep := range d.dependencies {
+		if state[dep.key] == unvisited {
+			visit(dep.key)
+		}
+	}
+}
+
+// relativePath resolves a path in the configuration relative to the directory of the configuration file
+func (d *decoder) relativePath(path string) string {
+	if path == "" || d.file == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(d.file), path)
+}
+
+func (d *decoder) decodeKey(n *node, path string) models.MappingMetadata {
+	meta := models.MappingMetadata{}
+	fields := d.fields(n, path, "key", "summarizer", "field_summarizers", "publish_summary_stats", "smoothed_fields", "endpoints", "derived", "schedule")
+	meta.Key = d.requiredStr(fields, n, path, "key")
+
+	if s, ok := fields["summarizer"]; ok {
+		name := d.str(s, join(path, "summarizer"))
+		if f, ok := d.registry.detailedSummaryFuncs[name]; ok {
+			meta.DetailedSummaryFunc = f
+		} else if f, ok := d.registry.summaryFuncs[name]; ok {
+			meta.SummaryFunc = f
+		} else {
+			d.errorf(s, join(path, "summarizer"), "unknown summarizer %q", name)
+		}
+	}
+	if s, ok := fields["field_summarizers"]; ok {
+		names := d.strMap(s, join(path, "field_summarizers"))
+		for _, field := range s.keys {
+			name := names[field]
+			if f, ok := d.registry.detailedSummaryFuncs[name]; ok {
+				if meta.FieldDetailedSummaryFuncs == nil {
+					meta.FieldDetailedSummaryFuncs = make(map[string]models.DetailedSummaryFunc)
+				}
+				meta.FieldDetailedSummaryFuncs[field] = f
+			} else if f, ok := d.registry.summaryFuncs[name]; ok {
+				if meta.FieldSummaryFuncs == nil {
+					meta.FieldSummaryFuncs = make(map[string]models.SummaryFunc)
+				}
+				meta.FieldSummaryFuncs[field] = f
+			} else {
+				d.errorf(s.fields[field], join(path, "field_summarizers", field), "unknown summarizer %q", name)
+			}
+		}
+	}
+	if s, ok := fields["publish_summary_stats"]; ok {
+		meta.PublishSummaryStats = d.boolean(s, join(path, "publish_summary_stats"))
+	}
+	if s, ok := fields["smoothed_fields"]; ok {
+		if s.kind != sequenceNode {
+			d.errorf(s, join(path, "smoothed_fields"), "expected a list, got %s", s.kind)
+		}
+		for i, item := range s.items {
+			meta.SmoothedFields = append(meta.SmoothedFields, d.decodeSmoothedField(item, index(join(path, "smoothed_fields"), i)))
+		}
+	}
+	if s, ok := fields["schedule"]; ok {
+		meta.Schedule = d.decodeSchedule(s, join(path, "schedule"))
+	}
+
+	_, hasEndpoints := fields["endpoints"]
+	derived, hasDerived := fields["derived"]
+	switch {
+	case hasEndpoints && hasDerived:
+		d.errorf(n, path, "a key must have either endpoints or derived, not both")
+	case hasDerived:
+		meta.Derived = d.decodeDerivation(derived, join(path, "derived"), meta.Key)
+	case hasEndpoints:
+		endpoints := fields["endpoints"]
+		if endpoints.kind != sequenceNode || len(endpoints.items) == 0 {
+			d.errorf(endpoints, join(path, "endpoints"), "expected a non-empty list of endpoints")
+			break
+		}
+		for i, item := range endpoints.items {
+			meta.Endpoints = append(meta.Endpoints, d.decodeEndpoint(item, index(join(path, "endpoints"), i)))
+		}
+	default:
+		d.errorf(n, path, "a key must have either endpoints or derived")
+	}
+	return meta
+}
+
+func (d *decoder) decodeEndpoint(n *node, path string) models.Endpoint {
+	endpoint := models.Endpoint{}
+	fields := d.fields(n, path, "url", "method", "headers", "body", "min_refresh", "transport", "group", "json_paths", "expressions", "normalize")
+	endpoint.Endpoint = d.requiredStr(fields, n, path, "url")
+	if m, ok := fields["method"]; ok {
+		endpoint.Method = strings.ToUpper(d.str(m, join(path, "method")))
+	}
+	if h, ok := fields["headers"]; ok {
+		endpoint.Headers = d.strMap(h, join(path, "headers"))
+	}
+	if b, ok := fields["body"]; ok {
+		endpoint.Body = d.str(b, join(path, "body"))
+	}
+	if m, ok := fields["min_refresh"]; ok {
+		endpoint.MinRefresh = d.duration(m, join(path, "min_refresh"))
+	}
+	if t, ok := fields["transport"]; ok {
+		endpoint.Transport = d.decodeTransport(t, join(path, "transport"))
+	}
+	if g, ok := fields["group"]; ok {
+		endpoint.Group = d.str(g, join(path, "group"))
+	}
+
+	jsonPaths, ok := fields["json_paths"]
+	if !ok {
+		d.errorf(n, path, "missing required field %q", "json_paths")
+		return endpoint
+	}
+	endpoint.JSONPaths = d.strMap(jsonPaths, join(path, "json_paths"))
+	for _, field := range jsonPaths.keys {
+		jsonPath := endpoint.JSONPaths[field]
+		if _, err := jsonpath.Compile(jsonPath); err != nil {
+			d.errorf(jsonPaths.fields[field], join(path, "json_paths", field), "invalid JSONPath %q: %v", jsonPath, err)
+		}
+	}
+
+	if e, ok := fields["expressions"]; ok {
+		endpoint.Expressions = d.strMap(e, join(path, "expressions"))
+		for _, field := range e.keys {
+			source := endpoint.Expressions[field]
+			single := models.Endpoint{JSONPaths: endpoint.JSONPaths, Expressions: map[string]string{field: source}}
+			if _, err := utils.NewExpressionNormalizer(single); err != nil {
+				d.errorf(e.fields[field], join(path, "expressions", field), "%v", err)
+			}
+		}
+	}
+	if s, ok := fields["normalize"]; ok {
+		name := d.str(s, join(path, "normalize"))
+		if f, ok := d.registry.normalizeFuncs[name]; ok {
+			endpoint.NormalizeFunc = f
+		} else {
+			d.errorf(s, join(path, "normalize"), "unknown normalization function %q", name)
+		}
+		if endpoint.Expressions != nil {
+			d.errorf(s, join(path, "normalize"), "an endpoint must not have both expressions and normalize")
+		}
+	}
+	return endpoint
+}
+
+func (d *decoder) decodeSmoothedField(n *node, path string) models.SmoothedField {
+	smoothed := models.SmoothedField{}
+	fields := d.fields(n, path, "field", "name", "twap", "ema_half_life", "smoothing", "window")
+	smoothed.Field = d.requiredStr(fields, n, path, "field")
+	if s, ok := fields["name"]; ok {
+		smoothed.Name = d.str(s, join(path, "name"))
+	}
+
+	count := 0
+	if s, ok := fields["twap"]; ok {
+		smoothed.Window = d.duration(s, join(path, "twap"))
+		smoothed.SmoothingFunc = summary.TWAP(smoothed.Window)
+		count++
+	}
+	if s, ok := fields["ema_half_life"]; ok {
+		smoothed.SmoothingFunc = summary.EMA(d.duration(s, join(path, "ema_half_life")))
+		count++
+	}
+	if s, ok := fields["smoothing"]; ok {
+		name := d.str(s, join(path, "smoothing"))
+		if f, ok := d.registry.smoothingFuncs[name]; ok {
+			smoothed.SmoothingFunc = f
+		} else {
+			d.errorf(s, join(path, "smoothing"), "unknown smoothing function %q", name)
+		}
+		count++
+	}
+	if count != 1 {
+		d.errorf(n, path, "exactly one of twap, ema_half_life or smoothing is required")
+	}
+	if s, ok := fields["window"]; ok {
+		if _, ok := fields["twap"]; ok {
+			d.errorf(s, join(path, "window"), "the window of twap is its duration")
+		}
+		smoothed.Window = d.duration(s, join(path, "window"))
+	}
+	return smoothed
+}
+
+func (d *decoder) decodeRateLimit(n *node, path string) models.RateLimit {
+	limit := models.RateLimit{}
+	fields := d.fields(n, path, "host", "group", "requests", "per", "burst", "daily_quota", "monthly_quota")
+	if h, ok := fields["host"]; ok {
+		limit.Host = d.str(h, join(path, "host"))
+	}
+	if g, ok := fields["group"]; ok {
+		limit.Group = d.str(g, join(path, "group"))
+	}
+	if (limit.Host == "") == (limit.Group == "") {
+		d.errorf(n, path, "exactly one of host or group is required")
+	}
+	if r, ok := fields["requests"]; ok {
+		limit.Requests = d.positiveInteger(r, join(path, "requests"))
+	}
+	if p, ok := fields["per"]; ok {
+		limit.Per = d.duration(p, join(path, "per"))
+	}
+	if b, ok := fields["burst"]; ok {
+		limit.Burst = d.positiveInteger(b, join(path, "burst"))
+	}
+	if q, ok := fields["daily_quota"]; ok {
+		limit.DailyQuota = d.positiveInteger(q, join(path, "daily_quota"))
+	}
+	if q, ok := fields["monthly_quota"]; ok {
+		limit.MonthlyQuota = d.positiveInteger(q, join(path, "monthly_quota"))
+	}
+	if limit.Requests == 0 && limit.DailyQuota == 0 && limit.MonthlyQuota == 0 {
+		d.errorf(n, path, "at least one of requests, daily_quota or monthly_quota is required")
+	}
+	return limit
+}
+
+func (d *decoder) decodeTransport(n *node, path string) *models.Transport {
+	t := &models.Transport{}
+	fields := d.fields(n, path, "root_ca_files", "client_cert_file", "client_key_file", "min_tls_version", "pinned_keys", "proxy_url")
+	if r, ok := fields["root_ca_files"]; ok {
+		for _, file := range d.strList(r, join(path, "root_ca_files")) {
+			t.RootCAFiles = append(t.RootCAFiles, d.relativePath(file))
+		}
+	}
+	if c, ok := fields["client_cert_file"]; ok {
+		t.ClientCertFile = d.relativePath(d.str(c, join(path, "client_cert_file")))
+	}
+	if k, ok := fields["client_key_file"]; ok {
+		t.ClientKeyFile = d.relativePath(d.str(k, join(path, "client_key_file")))
+	}
+	if (t.ClientCertFile == "") != (t.ClientKeyFile == "") {
+		d.errorf(n, path, "client_cert_file and client_key_file must be set together")
+	}
+	if v, ok := fields["min_tls_version"]; ok {
+		t.MinTLSVersion = d.str(v, join(path, "min_tls_version"))
+		switch t.MinTLSVersion {
+		case "1.0", "1.1", "1.2", "1.3":
+		default:
+			d.errorf(v, join(path, "min_tls_version"), "expected 1.0, 1.1, 1.2 or 1.3, got %q", t.MinTLSVersion)
+		}
+	}
+	if p, ok := fields["pinned_keys"]; ok {
+		t.PinnedKeys = d.strList(p, join(path, "pinned_keys"))
+	}
+	if p, ok := fields["proxy_url"]; ok {
+		t.ProxyURL = d.str(p, join(path, "proxy_url"))
+	}
+	return t
+}
+
+func (d *decoder) decodeSchedule(n *node, path string) *models.Schedule {
+	s := &models.Schedule{}
+	errs := len(d.errs)
+	fields := d.fields(n, path, "interval", "cron", "timezone", "jitter")
+	if i, ok := fields["interval"]; ok {
+		s.Interval = d.duration(i, join(path, "interval"))
+	}
+	if c, ok := fields["cron"]; ok {
+		s.Cron = d.str(c, join(path, "cron"))
+	}
+	if tz, ok := fields["timezone"]; ok {
+		s.Timezone = d.str(tz, join(path, "timezone"))
+	}
+	if j, ok := fields["jitter"]; ok {
+		s.Jitter = d.duration(j, join(path, "jitter"))
+	}
+	if len(d.errs) == errs {
+		if _, err := schedule.Compile(*s); err != nil {
+			d.errorf(n, path, "%v", err)
+		}
+	}
+	return s
+}
+
+func (d *decoder) decodeDerivation(n *node, path string, key string) *models.Derivation {
+	derivation := &models.Derivation{}
+	fields := d.fields(n, path, "expressions", "func", "depends_on")
+	if e, ok := fields["expressions"]; ok {
+		derivation.Expressions = d.strMap(e, join(path, "expressions"))
+		for _, field := range e.keys {
+			source := derivation.Expressions[field]
+			compiled, err := expr.Compile(source)
+			if err != nil {
+				d.errorf(e.fields[field], join(path, "expressions", field), "%v", err)
+				continue
+			}
+			for _, name := range compiled.Vars() {
+				dependsOn, _, ok := expr.SplitVar(name)
+				if !ok {
+					d.errorf(e.fields[field], join(path, "expressions", field), "%s does not reference a key's field, expected key.field", name)
+					continue
+				}
+				d.dependencies = append(d.dependencies, dependency{key: key, dependsOn: dependsOn, n: e.fields[field], path: join(path, "expressions", field)})
+			}
+		}
+	}
+	if s, ok := fields["func"]; ok {
+		name := d.str(s, join(path, "func"))
+		if f, ok := d.registry.deriveFuncs[name]; ok {
+			derivation.Func = f
+		} else {
+			d.errorf(s, join(path, "func"), "unknown derive function %q", name)
+		}
+	}
+	if s, ok := fields["depends_on"]; ok {
+		derivation.DependsOn = d.strList(s, join(path, "depends_on"))
+		for i, dependsOn := range derivation.DependsOn {
+			d.dependencies = append(d.dependencies, dependency{key: key, dependsOn: dependsOn, n: s.items[i], path: index(join(path, "depends_on"), i)})
+		}
+	}
+	if derivation.Expressions == nil && derivation.Func == nil {
+		d.errorf(n, path, "expressions or func is required")
+	}
+	return derivation
+}
+
+func join(path string, keys ...string) string {
+	for _, key := range keys {
+		if path == "" {
+			path = key
+		} else {
+			path += "." + key
+		}
+	}
+	return path
+}
+
+func index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
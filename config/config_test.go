@@ -0,0 +1,331 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+const validYAML = `
+canister_name: crypto_oracle
+update_interval: 1m
+max_concurrent_keys: 8
+max_requests_per_host: 2
+rate_limits:
+  - host: api.example.com
+    requests: 30
+    daily_quota: 10000
+  - group: paid
+    monthly_quota: 100000
+keys:
+  - key: ETH/USD
+    summarizer: median
+    field_summarizers:
+      volume: custom
+    publish_summary_stats: true
+    smoothed_fields:
+      - field: price
+        name: price_twap
+        twap: 1h
+    endpoints:
+      - url: https://api.example.com/eth
+        method: post
+        headers:
+          X-Api-Key: secret
+        body: '{"pair": "ETH/USD"}'
+        min_refresh: 1h
+        transport:
+          min_tls_version: "1.3"
+          pinned_keys:
+            - sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=
+        json_paths:
+          bid: $.bid
+          ask: $.ask
+        expressions:
+          price: (bid + ask) / 2
+  - key: ETH/BTC
+    schedule:
+      cron: "*/5 * * * *"
+      timezone: Europe/Zurich
+      jitter: 10s
+    derived:
+      expressions:
+        price: "[ETH/USD].price / 2"
+`
+
+func TestParseYAML(t *testing.T) {
+	registry := NewRegistry()
+	registry.RegisterSummaryFunc("custom", func(dataset []map[string]float64) map[string]float64 { return nil })
+
+	config, engine, err := Parse([]byte(validYAML), YAML, registry)
+	if err != nil {
+		t.Fatalf("Could not parse configuration: %v", err)
+	}
+
+	if config.CanisterName != "crypto_oracle" || config.UpdateInterval != time.Minute || config.MaxConcurrentKeys != 8 || config.MaxRequestsPerHost != 2 {
+		t.Errorf("Incorrect config %+v", config)
+	}
+	if len(engine.Metadata) != 2 {
+		t.Fatalf("Expected 2 keys, got %d", len(engine.Metadata))
+	}
+	eth := engine.Metadata[0]
+	if eth.Key != "ETH/USD" || eth.DetailedSummaryFunc == nil || eth.FieldSummaryFuncs["volume"] == nil || !eth.PublishSummaryStats {
+		t.Errorf("Incorrect metadata %+v", eth)
+	}
+	if len(eth.SmoothedFields) != 1 || eth.SmoothedFields[0].Name != "price_twap" || eth.SmoothedFields[0].SmoothingFunc == nil ||
+		eth.SmoothedFields[0].Window != time.Hour {
+		t.Errorf("Incorrect smoothed fields %+v", eth.SmoothedFields)
+	}
+	if len(eth.Endpoints) != 1 || eth.Endpoints[0].Method != "POST" || eth.Endpoints[0].Headers["X-Api-Key"] != "secret" || eth.Endpoints[0].Body != `{"pair": "ETH/USD"}` || eth.Endpoints[0].MinRefresh != time.Hour {
+		t.Errorf("Incorrect request of endpoint %+v", eth.Endpoints)
+	}
+	if tr := eth.Endpoints[0].Transport; tr == nil || tr.MinTLSVersion != "1.3" || len(tr.PinnedKeys) != 1 {
+		t.Errorf("Incorrect transport of endpoint %+v", tr)
+	}
+	if len(config.RateLimits) != 2 || config.RateLimits[0] != (models.RateLimit{Host: "api.example.com", Requests: 30, DailyQuota: 10000}) || config.RateLimits[1].Group != "paid" {
+		t.Errorf("Incorrect rate limits %+v", config.RateLimits)
+	}
+	if len(eth.Endpoints) != 1 || eth.Endpoints[0].JSONPaths["ask"] != "$.ask" || eth.Endpoints[0].Expressions["price"] != "(bid + ask) / 2" {
+		t.Errorf("Incorrect endpoints %+v", eth.Endpoints)
+	}
+	if engine.Metadata[1].Derived == nil || engine.Metadata[1].Derived.Expressions["price"] == "" {
+		t.Errorf("Incorrect derived key %+v", engine.Metadata[1])
+	}
+	if s := engine.Metadata[1].Schedule; s == nil || *s != (models.Schedule{Cron: "*/5 * * * *", Timezone: "Europe/Zurich", Jitter: 10 * time.Second}) {
+		t.Errorf("Incorrect schedule %+v", s)
+	}
+}
+
+func TestLoadResolvesProjectSettings(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "oracle.yaml")
+	document := validYAML + `
+project_dir: project
+canister_template: templates/main.mo.tmpl
+quota_file: state/quota.json
+transport:
+  root_ca_files: [certs/ca.pem]
+  proxy_url: http://proxy.internal:3128
+networks:
+  staging: https://staging.example.com
+canister_settings:
+  compute_allocation: 10
+  memory_allocation: 2GB
+`
+	if err := ioutil.WriteFile(path, []byte(document), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry := NewRegistry()
+	registry.RegisterSummaryFunc("custom", func(dataset []map[string]float64) map[string]float64 { return nil })
+
+	config, _, err := Load(path, registry)
+	if err != nil {
+		t.Fatalf("Could not load configuration: %v", err)
+	}
+	if config.ProjectDir != filepath.Join(dir, "project") {
+		t.Errorf("Expected project directory relative to the configuration file, got %s", config.ProjectDir)
+	}
+	if config.CanisterTemplateFile != filepath.Join(dir, "templates", "main.mo.tmpl") {
+		t.Errorf("Expected canister template relative to the configuration file, got %s", config.CanisterTemplateFile)
+	}
+	if config.QuotaFile != filepath.Join(dir, "state", "quota.json") {
+		t.Errorf("Expected quota file relative to the configuration file, got %s", config.QuotaFile)
+	}
+	if tr := config.Transport; tr == nil || len(tr.RootCAFiles) != 1 || tr.RootCAFiles[0] != filepath.Join(dir, "certs", "ca.pem") || tr.ProxyURL != "http://proxy.internal:3128" {
+		t.Errorf("Expected root CA files relative to the configuration file, got %+v", tr)
+	}
+	if config.Networks["staging"] != "https://staging.example.com" {
+		t.Errorf("Incorrect networks %v", config.Networks)
+	}
+	if config.CanisterSettings.ComputeAllocation != 10 || config.CanisterSettings.MemoryAllocation != "2GB" {
+		t.Errorf("Incorrect canister settings %+v", config.CanisterSettings)
+	}
+}
+
+func TestParseJSONAndTOML(t *testing.T) {
+	jsonDocument := `{"canister_name": "c", "update_interval": "5m", "keys": [{"key": "k", "endpoints": [{"url": "http://x", "json_paths": {"v": "$.v"}}]}]}`
+	tomlDocument := `
+canister_name = "c"
+update_interval = "5m"
+
+[[keys]]
+key = "k"
+
+[[keys.endpoints]]
+url = "http://x"
+json_paths = { v = "$.v" }
+`
+	for format, document := range map[Format]string{JSON: jsonDocument, TOML: tomlDocument} {
+		config, engine, err := Parse([]byte(document), format, nil)
+		if err != nil {
+			t.Errorf("Could not parse %s configuration: %v", format, err)
+			continue
+		}
+		if config.UpdateInterval != 5*time.Minute || len(engine.Metadata) != 1 || engine.Metadata[0].Endpoints[0].JSONPaths["v"] != "$.v" {
+			t.Errorf("Incorrect %s configuration %+v %+v", format, config, engine)
+		}
+	}
+}
+
+func TestParseReportsAllErrors(t *testing.T) {
+	document := `
+canister_name: oracle
+update_interval: soon
+keys:
+  - key: A
+    summarizer: nonexistent
+    endpoints:
+      - url: http://x
+        json_paths:
+          v: "$.v"
+        expressions:
+          w: missing * 2
+        extra: true
+  - key: A
+    derived:
+      expressions:
+        x: "1 +"
+  - key: B
+    schedule:
+      interval: 1m
+      cron: "61 * * * *"
+    derived:
+      expressions:
+        x: "A.v"
+  - key: C
+    schedule:
+      cron: "0 0 * * *"
+      timezone: Mars/Olympus_Mons
+    derived:
+      expressions:
+        x: "A.v"
+history_size: -5
+`
+	_, _, err := Parse([]byte(document), YAML, nil)
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected configuration errors, got %v", err)
+	}
+	expected := []string{
+		"3:18: update_interval: expected a positive duration",
+		"6:17: keys[0].summarizer: unknown summarizer",
+		"13:16: keys[0].endpoints[0].extra: unknown field",
+		"12:14: keys[0].endpoints[0].expressions.w: field w: missing is not one of the endpoint's JSONPaths",
+		"14:5: keys[1]: duplicate key \"A\", already defined at keys[0]",
+		"17:12: keys[1].derived.expressions.x:",
+		"20:7: keys[2].schedule: A schedule must have either an interval or a cron expression, not both",
+		"27:7: keys[3].schedule: Invalid schedule timezone \"Mars/Olympus_Mons\"",
+		"32:15: history_size: expected a positive integer",
+	}
+	message := err.Error()
+	for _, e := range expected {
+		if !strings.Contains(message, e) {
+			t.Errorf("Expected error containing %q in:\n%s", e, message)
+		}
+	}
+	if len(errs) != len(expected) {
+		t.Errorf("Expected %d errors, got %d:\n%s", len(expected), len(errs), message)
+	}
+}
+
+func TestParseChecksDerivedKeyDependencies(t *testing.T) {
+	document := `
+canister_name: oracle
+update_interval: 1m
+keys:
+  - key: a
+    derived:
+      expressions:
+        v: b.v * 2
+  - key: b
+    derived:
+      expressions:
+        v: a.v
+  - key: c
+    derived:
+      func: ratio
+      depends_on: [a, missing]
+`
+	registry := NewRegistry()
+	registry.RegisterDeriveFunc("ratio", func(map[string]map[string]float64) (map[string]float64, error) { return nil, nil })
+
+	_, _, err := Parse([]byte(document), YAML, registry)
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected configuration errors, got %v", err)
+	}
+	expected := []string{
+		"12:12: keys[1].derived.expressions.v: derived keys form a cycle: a -> b -> a",
+		"16:23: keys[2].derived.depends_on[1]: unknown key \"missing\"",
+	}
+	message := err.Error()
+	for _, e := range expected {
+		if !strings.Contains(message, e) {
+			t.Errorf("Expected error containing %q in:\n%s", e, message)
+		}
+	}
+	if len(errs) != len(expected) {
+		t.Errorf("Expected %d errors, got %d:\n%s", len(expected), len(errs), message)
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(tempDir(t), "oracle.yaml")
+	registry := NewRegistry()
+	registry.RegisterSummaryFunc("custom", func(dataset []map[string]float64) map[string]float64 { return nil })
+	if err := ioutil.WriteFile(path, []byte(validYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloads := make(chan error, 10)
+	go Watch(ctx, path, registry, 5*time.Millisecond, func(config *models.Config, engine *models.Engine, err error) {
+		reloads <- err
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	ioutil.WriteFile(path, []byte(strings.Replace(validYAML, "update_interval: 1m", "update_interval: 2m", 1)), 0644)
+	select {
+	case err := <-reloads:
+		if err != nil {
+			t.Errorf("Expected the changed file to load, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the changed file to be reloaded")
+	}
+
+	ioutil.WriteFile(path, []byte("canister_name: [invalid"), 0644)
+	select {
+	case err := <-reloads:
+		if err == nil {
+			t.Errorf("Expected an error for the invalid file")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the invalid file to be reported")
+	}
+	select {
+	case <-reloads:
+		t.Errorf("Expected no reload while the file is unchanged")
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+// tempDir creates a temporary directory that is removed when the test ends
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oracle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
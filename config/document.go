@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type nodeKind int
+
+const (
+	nullNode nodeKind = iota
+	scalarNode
+	mappingNode
+	sequenceNode
+)
+
+func (k nodeKind) String() string {
+	switch k {
+	case scalarNode:
+		return "a value"
+	case mappingNode:
+		return "a mapping"
+	case sequenceNode:
+		return "a list"
+	}
+	return "null"
+}
+
+// node is a format-independent view of a parsed configuration document, remembering where each value came from
+type node struct {
+	kind   nodeKind
+	value  string
+	keys   []string
+	fields map[string]*node
+	items  []*node
+	line   int // 1-based, or 0 if the format doesn't report positions
+	column int
+}
+
+// fromYAML converts a YAML (or JSON, which is a subset of YAML) document into a node tree
+func fromYAML(n *yaml.Node) (*node, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return &node{kind: nullNode, line: n.Line, column: n.Column}, nil
+		}
+		return fromYAML(n.Content[0])
+	case yaml.AliasNode:
+		return fromYAML(n.Alias)
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return &node{kind: nullNode, line: n.Line, column: n.Column}, nil
+		}
+		return &node{kind: scalarNode, value: n.Value, line: n.Line, column: n.Column}, nil
+	case yaml.SequenceNode:
+		result := &node{kind: sequenceNode, line: n.Line, column: n.Column}
+		for _, item := range n.Content {
+			child, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			result.items = append(result.items, child)
+		}
+		return result, nil
+	case yaml.MappingNode:
+		result := &node{kind: mappingNode, fields: make(map[string]*node), line: n.Line, column: n.Column}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if _, ok := result.fields[key]; ok {
+				return nil, fmt.Errorf("line %d: duplicate key %q", n.Content[i].Line, key)
+			}
+			child, err := fromYAML(n.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			result.keys = append(result.keys, key)
+			result.fields[key] = child
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", n.Line)
+}
+
+// fromValue converts a value decoded by the TOML parser into a node tree; TOML values have no recorded positions
+func fromValue(value interface{}) *node {
+	switch v := value.(type) {
+	case nil:
+		return &node{kind: nullNode}
+	case map[string]interface{}:
+		result := &node{kind: mappingNode, fields: make(map[string]*node)}
+		for key := range v {
+			result.keys = append(result.keys, key)
+		}
+		sort.Strings(result.keys)
+		for _, key := range result.keys {
+			result.fields[key] = fromValue(v[key])
+		}
+		return result
+	case []map[string]interface{}:
+		result := &node{kind: sequenceNode}
+		for _, item := range v {
+			result.items = append(result.items, fromValue(item))
+		}
+		return result
+	case []interface{}:
+		result := &node{kind: sequenceNode}
+		for _, item := range v {
+			result.items = append(result.items, fromValue(item))
+		}
+		return result
+	case string:
+		return &node{kind: scalarNode, value: v}
+	case int64:
+		return &node{kind: scalarNode, value: strconv.FormatInt(v, 10)}
+	case float64:
+		return &node{kind: scalarNode, value: strconv.FormatFloat(v, 'g', -1, 64)}
+	case bool:
+		return &node{kind: scalarNode, value: strconv.FormatBool(v)}
+	case time.Time:
+		return &node{kind: scalarNode, value: v.Format(time.RFC3339)}
+	}
+	return &node{kind: scalarNode, value: fmt.Sprint(value)}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/summary"
+)
+
+// NormalizeFunc is the type of models.Endpoint.NormalizeFunc
+type NormalizeFunc func(map[string]interface{}) (map[string]float64, error)
+
+// DeriveFunc is the type of models.Derivation.Func
+type DeriveFunc func(map[string]map[string]float64) (map[string]float64, error)
+
+// Registry holds the Go functions that configuration files can refer to by name
+type Registry struct {
+	summaryFuncs         map[string]models.SummaryFunc
+	detailedSummaryFuncs map[string]models.DetailedSummaryFunc
+	normalizeFuncs       map[string]NormalizeFunc
+	deriveFuncs          map[string]DeriveFunc
+	smoothingFuncs       map[string]models.SmoothingFunc
+}
+
+// NewRegistry creates a registry containing the built-in summarizers of the summary package: "mean", "median",
+// "mode", "max", "min", "mean_without_outliers" and "median_without_outliers"
+func NewRegistry() *Registry {
+	r := &Registry{
+		summaryFuncs:         make(map[string]models.SummaryFunc),
+		detailedSummaryFuncs: make(map[string]models.DetailedSummaryFunc),
+		normalizeFuncs:       make(map[string]NormalizeFunc),
+		deriveFuncs:          make(map[string]DeriveFunc),
+		smoothingFuncs:       make(map[string]models.SmoothingFunc),
+	}
+	r.RegisterDetailedSummaryFunc("mean", summary.MeanDetailed)
+	r.RegisterDetailedSummaryFunc("median", summary.MedianDetailed)
+	r.RegisterDetailedSummaryFunc("mode", summary.ModeDetailed)
+	r.RegisterDetailedSummaryFunc("max", summary.MaxDetailed)
+	r.RegisterDetailedSummaryFunc("min", summary.MinDetailed)
+	r.RegisterDetailedSummaryFunc("mean_without_outliers", summary.MeanWithoutOutliersDetailed)
+	r.RegisterDetailedSummaryFunc("median_without_outliers", summary.MedianWithoutOutliersDetailed)
+	return r
+}
+
+// RegisterSummaryFunc makes a summarizer available under the given name, replacing any summarizer with that name
+func (r *Registry) RegisterSummaryFunc(name string, f models.SummaryFunc) {
+	delete(r.detailedSummaryFuncs, name)
+	r.summaryFuncs[name] = f
+}
+
+// RegisterDetailedSummaryFunc makes a detailed summarizer available under the given name, replacing any summarizer
+// with that name
+func (r *Registry) RegisterDetailedSummaryFunc(name string, f models.DetailedSummaryFunc) {
+	delete(r.summaryFuncs, name)
+	r.detailedSummaryFuncs[name] = f
+}
+
+// RegisterNormalizeFunc makes an endpoint normalization function available under the given name
+func (r *Registry) RegisterNormalizeFunc(name string, f NormalizeFunc) {
+	r.normalizeFuncs[name] = f
+}
+
+// RegisterDeriveFunc makes a derived key function available under the given name
+func (r *Registry) RegisterDeriveFunc(name string, f DeriveFunc) {
+	r.deriveFuncs[name] = f
+}
+
+// RegisterSmoothingFunc makes a smoothing function available under the given name
+func (r *Registry) RegisterSmoothingFunc(name string, f models.SmoothingFunc) {
+	r.smoothingFuncs[name] = f
+}
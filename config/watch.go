@@ -0,0 +1,37 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// ReloadFunc receives a configuration reloaded by Watch, or the error that prevented loading it
+type ReloadFunc func(config *models.Config, engine *models.Engine, err error)
+
+// Watch checks the configuration file at the given path for changes at the given interval until the context is
+// cancelled. Whenever its contents change, it is loaded again and passed to reload, along with any error loading it.
+// Polling the contents rather than watching for file system events also picks up files that editors and configuration
+// management tools replace rather than modify.
+func Watch(ctx context.Context, path string, registry *Registry, interval time.Duration, reload ReloadFunc) {
+	previous, _ := ioutil.ReadFile(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil || bytes.Equal(contents, previous) {
+			// a missing file is usually being replaced, so it is checked again at the next interval
+			continue
+		}
+		previous = contents
+		reload(Load(path, registry))
+	}
+}
@@ -0,0 +1,254 @@
+package framework
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyplabs/dfinity-oracle-framework/expr"
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/schedule"
+	"github.com/hyplabs/dfinity-oracle-framework/summary"
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+)
+
+// roundPlan is the order in which keys are updated each round, along with the compiled derivations of derived keys,
+// schedules of keys and normalization expressions of endpoints
+type roundPlan struct {
+	metadata    []models.MappingMetadata
+	derivations map[string]*derivation
+	schedules   map[string]*schedule.Spec // keys with their own schedule
+}
+
+// derivation is a compiled models.Derivation
+type derivation struct {
+	expressions map[string]*expr.Expr
+	dependsOn   []string
+}
+
+// newRoundPlan validates the engine's metadata, compiles its derivations, and orders it so that every derived key is
+// updated after the keys it depends on
+func newRoundPlan(engine *models.Engine) (*roundPlan, error) {
+	plan := &roundPlan{derivations: make(map[string]*derivation), schedules: make(map[string]*schedule.Spec)}
+	byKey := make(map[string]models.MappingMetadata)
+	for _, meta := range engine.Metadata {
+		if _, ok := byKey[meta.Key]; ok {
+			return nil, fmt.Errorf("Duplicate key %s", meta.Key)
+		}
+		meta, err := compileNormalizers(meta)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateSmoothedFields(meta); err != nil {
+			return nil, err
+		}
+		if err := validateSummaryStats(meta); err != nil {
+			return nil, err
+		}
+		byKey[meta.Key] = meta
+		if meta.Schedule != nil {
+			spec, err := schedule.Compile(*meta.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("Schedule of %s: %w", meta.Key, err)
+			}
+			plan.schedules[meta.Key] = spec
+		}
+		if meta.Derived == nil {
+			continue
+		}
+		d, err := compileDerivation(meta)
+		if err != nil {
+			return nil, err
+		}
+		plan.derivations[meta.Key] = d
+	}
+	for key, d := range plan.derivations {
+		for _, dep := range d.dependsOn {
+			if _, ok := byKey[dep]; !ok {
+				return nil, fmt.Errorf("Derived key %s depends on unknown key %s", key, dep)
+			}
+		}
+	}
+
+	// depth-first topological sort, keeping the configured order wherever dependencies allow
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(key string) error
+	visit = func(key string) error {
+		switch state[key] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for path[start] != key {
+				start++
+			}
+			return fmt.Errorf("Derived keys form a cycle: %s", strings.Join(append(path[start:], key), " -> "))
+		}
+		state[key] = visiting
+		path = append(path, key)
+		if d, ok := plan.derivations[key]; ok {
+			for _, dep := range d.dependsOn {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[key] = visited
+		plan.metadata = append(plan.metadata, byKey[key])
+		return nil
+	}
+	for _, meta := range engine.Metadata {
+		if err := visit(meta.Key); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// compileNormalizers returns a copy of the given metadata in which every endpoint with Expressions normalizes its
+// values using them
+func compileNormalizers(meta models.MappingMetadata) (models.MappingMetadata, error) {
+	endpoints := make([]models.Endpoint, len(meta.Endpoints))
+	for i, endpoint := range meta.Endpoints {
+		if len(endpoint.Expressions) > 0 {
+			if endpoint.NormalizeFunc != nil {
+				return meta, fmt.Errorf("Endpoint %s of %s has both Expressions and a NormalizeFunc", endpoint.Endpoint, meta.Key)
+			}
+			normalizeFunc, err := utils.NewExpressionNormalizer(endpoint)
+			if err != nil {
+				return meta, fmt.Errorf("Endpoint %s of %s: %w", endpoint.Endpoint, meta.Key, err)
+			}
+			endpoint.NormalizeFunc = normalizeFunc
+		}
+		endpoints[i] = endpoint
+	}
+	meta.Endpoints = endpoints
+	return meta, nil
+}
+
+// twapFuncName is the name of the smoothing functions returned by summary.TWAP, whose history must be kept for their
+// window
+var twapFuncName = summaryFuncName(summary.TWAP(0))
+
+// validateSmoothedFields returns an error if any smoothed field of the given metadata can't be computed
+func validateSmoothedFields(meta models.MappingMetadata) error {
+	for i, smoothed := range meta.SmoothedFields {
+		switch {
+		case smoothed.Field == "":
+			return fmt.Errorf("Smoothed field %d of %s has no field", i, meta.Key)
+		case smoothed.SmoothingFunc == nil:
+			return fmt.Errorf("Smoothed field %s of %s has no smoothing function", smoothed.Field, meta.Key)
+		case smoothed.Window < 0:
+			return fmt.Errorf("Smoothed field %s of %s has a negative window", smoothed.Field, meta.Key)
+		case smoothed.Window == 0 && summaryFuncName(smoothed.SmoothingFunc) == twapFuncName:
+			return fmt.Errorf("Smoothed field %s of %s uses summary.TWAP but has no Window, which must be set to the window of the TWAP", smoothed.Field, meta.Key)
+		}
+	}
+	return nil
+}
+
+// validateSummaryStats returns an error if the summary statistics of the given metadata would have the same name as
+// any of its fields or smoothed fields
+func validateSummaryStats(meta models.MappingMetadata) error {
+	if !meta.PublishSummaryStats || meta.Derived != nil {
+		return nil
+	}
+	fields := make(map[string]bool)
+	for _, endpoint := range meta.Endpoints {
+		names := endpoint.JSONPaths
+		if len(endpoint.Expressions) > 0 {
+			names = endpoint.Expressions
+		}
+		for field := range names {
+			fields[field] = true
+		}
+	}
+	names := make(map[string]bool)
+	for field := range fields {
+		names[field] = true
+	}
+	for _, smoothed := range meta.SmoothedFields {
+		names[smoothed.Name] = true
+	}
+	for field := range fields {
+		for _, suffix := range summaryStatsSuffixes {
+			if names[field+suffix] {
+				return fmt.Errorf("Field %s of %s has the same name as a summary statistic of field %s", field+suffix, meta.Key, field)
+			}
+		}
+	}
+	return nil
+}
+
+func compileDerivation(meta models.MappingMetadata) (*derivation, error) {
+	if len(meta.Derived.Expressions) == 0 && meta.Derived.Func == nil {
+		return nil, fmt.Errorf("Derived key %s has neither expressions nor a function", meta.Key)
+	}
+
+	d := &derivation{expressions: make(map[string]*expr.Expr)}
+	deps := make(map[string]bool)
+	for _, dep := range meta.Derived.DependsOn {
+		deps[dep] = true
+	}
+	for field, source := range meta.Derived.Expressions {
+		e, err := expr.Compile(source)
+		if err != nil {
+			return nil, fmt.Errorf("Derived field %s of %s: %w", field, meta.Key, err)
+		}
+		for _, name := range e.Vars() {
+			key, _, ok := expr.SplitVar(name)
+			if !ok {
+				return nil, fmt.Errorf("Derived field %s of %s: %s does not reference a key's field, expected key.field", field, meta.Key, name)
+			}
+			deps[key] = true
+		}
+		d.expressions[field] = e
+	}
+	for dep := range deps {
+		d.dependsOn = append(d.dependsOn, dep)
+	}
+	sort.Strings(d.dependsOn)
+	return d, nil
+}
+
+// derive computes the fields of a derived key from the latest values published for its dependencies
+func (d *derivation) derive(meta models.MappingMetadata, round map[string]map[string]float64) (map[string]float64, error) {
+	deps := make(map[string]map[string]float64)
+	vars := make(map[string]float64)
+	for _, dep := range d.dependsOn {
+		values, ok := round[dep]
+		if !ok {
+			return nil, fmt.Errorf("Dependency %s of derived key %s has no current value", dep, meta.Key)
+		}
+		deps[dep] = values
+		for field, value := range values {
+			vars[dep+"."+field] = value
+		}
+	}
+
+	result := make(map[string]float64)
+	if meta.Derived.Func != nil {
+		values, err := meta.Derived.Func(deps)
+		if err != nil {
+			return nil, fmt.Errorf("Could not derive %s: %w", meta.Key, err)
+		}
+		for field, value := range values {
+			result[field] = value
+		}
+	}
+	for field, e := range d.expressions {
+		value, err := e.Eval(vars)
+		if err != nil {
+			return nil, fmt.Errorf("Could not derive field %s of %s: %w", field, meta.Key, err)
+		}
+		result[field] = value
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package framework
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/summary"
+)
+
+func TestRoundPlanOrdersDerivedKeys(t *testing.T) {
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "ETH/BTC", Derived: &models.Derivation{Expressions: map[string]string{"price": "[ETH/USD].price / [BTC/USD].price"}}},
+		{Key: "ETH/USD"},
+		{Key: "BTC/USD"},
+	}}
+
+	plan, err := newRoundPlan(engine)
+	if err != nil {
+		t.Fatalf("Could not plan round: %v", err)
+	}
+
+	var order []string
+	for _, meta := range plan.metadata {
+		order = append(order, meta.Key)
+	}
+	if strings.Join(order, ",") != "BTC/USD,ETH/USD,ETH/BTC" {
+		t.Errorf("Incorrect update order %v", order)
+	}
+
+	round := map[string]map[string]float64{"ETH/USD": {"price": 3000}, "BTC/USD": {"price": 60000}}
+	values, err := plan.derivations["ETH/BTC"].derive(engine.Metadata[0], round)
+	if err != nil || values["price"] != 0.05 {
+		t.Errorf("Incorrect derived value %v (error %v)", values, err)
+	}
+}
+
+func TestRoundPlanDetectsCycles(t *testing.T) {
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "A", Derived: &models.Derivation{Expressions: map[string]string{"x": "B.x + 1"}}},
+		{Key: "B", Derived: &models.Derivation{DependsOn: []string{"A"}, Func: func(map[string]map[string]float64) (map[string]float64, error) {
+			return nil, nil
+		}}},
+	}}
+
+	_, err := newRoundPlan(engine)
+	if err == nil || !strings.Contains(err.Error(), "A -> B -> A") {
+		t.Errorf("Expected a cycle error, got %v", err)
+	}
+}
+
+func TestRoundPlanRejectsUnknownDependencies(t *testing.T) {
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "A", Derived: &models.Derivation{Expressions: map[string]string{"x": "missing.x"}}},
+	}}
+
+	if _, err := newRoundPlan(engine); err == nil {
+		t.Errorf("Expected an unknown dependency error")
+	}
+}
+
+func TestRoundPlanRejectsInvalidSmoothedFields(t *testing.T) {
+	for _, smoothed := range []models.SmoothedField{
+		{Field: "price"},
+		{SmoothingFunc: summary.EMA(time.Minute)},
+		{Field: "price", SmoothingFunc: summary.TWAP(time.Hour), Window: -time.Hour},
+		{Field: "price", SmoothingFunc: summary.TWAP(time.Hour)},
+	} {
+		engine := &models.Engine{Metadata: []models.MappingMetadata{{Key: "A", SmoothedFields: []models.SmoothedField{smoothed}}}}
+		if _, err := newRoundPlan(engine); err == nil {
+			t.Errorf("Expected an error for smoothed field %+v", smoothed)
+		}
+	}
+}
+
+func TestRoundPlanRejectsSummaryStatsCollisions(t *testing.T) {
+	price := []models.Endpoint{{Endpoint: "https://a.example", JSONPaths: map[string]string{"price": "$.price"}}}
+	for _, meta := range []models.MappingMetadata{
+		{Key: "A", PublishSummaryStats: true, Endpoints: []models.Endpoint{
+			price[0],
+			{Endpoint: "https://b.example", JSONPaths: map[string]string{"price_stddev": "$.stddev"}},
+		}},
+		{Key: "A", PublishSummaryStats: true, Endpoints: price, SmoothedFields: []models.SmoothedField{
+			{Field: "price", Name: "price_max", SmoothingFunc: summary.EMA(time.Minute)},
+		}},
+	} {
+		if _, err := newRoundPlan(&models.Engine{Metadata: []models.MappingMetadata{meta}}); err == nil {
+			t.Errorf("Expected an error for colliding summary statistics of %+v", meta)
+		}
+	}
+
+	engine := &models.Engine{Metadata: []models.MappingMetadata{{Key: "A", PublishSummaryStats: true, Endpoints: price}}}
+	if _, err := newRoundPlan(engine); err != nil {
+		t.Errorf("Expected no error without colliding names, got %v", err)
+	}
+}
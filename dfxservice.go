@@ -1,12 +1,15 @@
 package framework
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hyplabs/dfinity-oracle-framework/models"
@@ -14,54 +17,127 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// defaultReplicaReadyTimeout is how long to wait for the local network to start when
+	// models.Config.ReplicaReadyTimeout is not set
+	defaultReplicaReadyTimeout = 60 * time.Second
+	replicaPollInterval        = 500 * time.Millisecond
+)
+
+// defaultWriterIdentity is the name of the writer identity when models.Config.WriterIdentity is not set
+const defaultWriterIdentity = "writer"
+
+// writerStateFile is the file in the project directory that records the writer identity after a rotation, so that
+// every process using the project, including one that is already running, writes with the new identity
+const writerStateFile = ".oracle-writer.json"
+
+// writerState is the format of writerStateFile
+type writerState struct {
+	Target   string `json:"target"`
+	Identity string `json:"identity"`
+}
+
 // DFXService contains various fields to be used by the DFX interface
 type DFXService struct {
-	config *models.Config
-	log    *logrus.Logger
+	config  *models.Config
+	log     *logrus.Logger
+	metrics *oracleMetrics
+
+	// writerMu is held for reading while writing to the canister, and for writing while switching writer identities
+	writerMu       sync.RWMutex
+	writerIdentity string
 }
 
-// NewDFXService creates an instance of DFX Service
+// NewDFXService creates an instance of DFX Service. The writer identity is the one recorded by the last rotation of the
+// writer for the same network and canister, if any, or the configured one otherwise.
 func NewDFXService(config *models.Config, log *logrus.Logger) *DFXService {
-	return &DFXService{
-		config,
-		log,
+	writerIdentity := config.WriterIdentity
+	if writerIdentity == "" {
+		writerIdentity = defaultWriterIdentity
+	}
+	s := &DFXService{
+		config:         config,
+		log:            log,
+		writerIdentity: writerIdentity,
 	}
+	s.refreshWriterIdentity()
+	return s
+}
+
+// target identifies the network and canister of this service, to tell whether state persisted in the project
+// directory applies to it
+func (s *DFXService) target() string {
+	return fmt.Sprintf("%s canister %s", s.config.Network, s.config.CanisterName)
 }
 
-func (s *DFXService) createNewDfxProject() error {
-	s.log.Infof("Creating new project %s...", s.config.CanisterName)
-	output, exitCode, err := dfxCall(".", []string{"new", s.config.CanisterName}, true)
+func (s *DFXService) updateCanisterCode() error {
+	s.log.Infof("Updating canister code...")
+	code, candid, err := renderCanister(s.config)
 	if err != nil {
-		s.log.WithError(err).Errorln("Could not create new project:", output)
+		s.log.WithError(err).Errorln("Could not render canister code")
 		return err
 	}
-	if exitCode != 0 && !strings.HasPrefix(output, "Cannot create a new project because the directory already exists.") {
-		s.log.WithError(err).Errorln("Could not create new project:", output)
-		return fmt.Errorf("Could not create new project: %v", output)
+	sourceDir := filepath.Join(s.projectDir(), "src", s.config.CanisterName)
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		s.log.WithError(err).Errorln("Could not create canister source directory")
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(sourceDir, "main.mo"), []byte(code), 0644); err != nil {
+		s.log.WithError(err).Errorln("Could not write to main.mo file")
+		return err
+	}
+	if err := ioutil.WriteFile(s.candidFile(), []byte(candid), 0644); err != nil {
+		s.log.WithError(err).Errorln("Could not write Candid interface file")
+		return err
 	}
 	return nil
 }
 
-func (s *DFXService) updateCanisterCode() error {
-	s.log.Infof("Updating canister code...")
-	fileName := filepath.Join(s.config.CanisterName, "src", s.config.CanisterName, "main.mo")
-	if err := ioutil.WriteFile(fileName, []byte(CodeTemplate), 0644); err != nil {
-		s.log.WithError(err).Errorln("Could not write to main.mo file")
-		return err
+// isReplicaHealthy checks whether the local replica is running and responding to requests
+func (s *DFXService) isReplicaHealthy() bool {
+	args := []string{"ping"}
+	if s.config.Network != "" {
+		args = append(args, s.config.Network)
+	}
+	_, exitCode, err := s.runDfx(args, true)
+	return err == nil && exitCode == 0
+}
+
+// waitForReplica polls the local replica until it is healthy, or returns an error once the configured timeout elapses
+func (s *DFXService) waitForReplica() error {
+	timeout := s.config.ReplicaReadyTimeout
+	if timeout == 0 {
+		timeout = defaultReplicaReadyTimeout
+	}
+	s.log.Infof("Waiting up to %v for the local network to become ready...", timeout)
+	deadline := time.Now().Add(timeout)
+	for !s.isReplicaHealthy() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Local network did not become ready within %v", timeout)
+		}
+		time.Sleep(replicaPollInterval)
 	}
+	s.log.Infof("Local network is ready")
 	return nil
 }
 
-func (s *DFXService) stopDfxNetwork() error {
-	s.log.Infof("Stopping existing DFX instances...")
-	_, _, err := dfxCall(s.config.CanisterName, []string{"stop"}, false)
-	if err != nil {
-		s.log.WithError(err).Errorln("Could not stop DFX identity")
+// startDfxNetworkIfNeeded starts the local network in the background unless a healthy replica is already running,
+// which is left untouched
+func (s *DFXService) startDfxNetworkIfNeeded() error {
+	if s.isReplicaHealthy() {
+		s.log.Infof("Using the network that is already running")
+		return nil
+	}
+	if !s.config.IsLocalNetwork() {
+		return fmt.Errorf("Network %s is not reachable", s.config.Network)
+	}
+	if s.config.UnmanagedReplica {
+		return fmt.Errorf("No healthy local network is running, and replica management is disabled")
+	}
+	if err := s.startDfxNetwork(); err != nil {
 		return err
 	}
-	s.log.Infoln("Sleeping 5 seconds to allow local network to finish shutting down...")
-	time.Sleep(5 * time.Second)
-	return nil
+	return s.waitForReplica()
 }
 
 func (s *DFXService) startDfxNetwork() error {
@@ -73,7 +149,7 @@ func (s *DFXService) startDfxNetwork() error {
 
 	dfxCommand := &exec.Cmd{
 		Path:   dfxExecutable,
-		Dir:    s.config.CanisterName,
+		Dir:    s.projectDir(),
 		Args:   []string{dfxExecutable, "start", "--background"},
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
@@ -82,28 +158,67 @@ func (s *DFXService) startDfxNetwork() error {
 		s.log.WithError(err).Errorln("Could not start local network")
 		return err
 	}
-	s.log.Infoln("Sleeping 5 seconds to allow local network to set up enough that we can make requests...")
-	time.Sleep(5 * time.Second)
 	return nil
 }
 
 func (s *DFXService) createWriterIdentityIfNeeded() error {
-	s.log.Infof("Creating writer identity...")
-	output, exitCode, err := dfxCall(s.config.CanisterName, []string{"identity", "new", "writer"}, true)
+	if s.config.WriterPEMFile != "" {
+		return s.importIdentityIfNeeded(s.currentWriterIdentity(), s.config.WriterPEMFile)
+	}
+	return s.createIdentityIfNeeded(s.currentWriterIdentity())
+}
+
+// identityExists checks whether a DFX identity with the given name exists
+func (s *DFXService) identityExists(identity string) (bool, error) {
+	output, _, err := s.runDfx([]string{"identity", "list"}, false)
 	if err != nil {
-		s.log.WithError(err).Errorln("Could not create new writer identity")
+		s.log.WithError(err).Errorln("Could not list identities:", output)
+		return false, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		// the selected identity is marked with an asterisk
+		if strings.TrimSuffix(strings.TrimSpace(line), " *") == identity {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *DFXService) createIdentityIfNeeded(identity string) error {
+	s.log.Infof("Creating identity %s...", identity)
+	output, exitCode, err := s.runDfx([]string{"identity", "new", identity}, true)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not create new identity", identity)
 		return err
 	}
-	if exitCode != 0 && !strings.HasPrefix(output, "Creating identity: \"writer\".\nIdentity already exists.") {
-		s.log.Errorln("Could not create new writer identity:", output)
+	if exitCode != 0 && !strings.Contains(output, "Identity already exists.") {
+		s.log.Errorln("Could not create new identity", identity+":", output)
+		return fmt.Errorf("Could not create new identity %s: %v", identity, output)
+	}
+	return nil
+}
+
+func (s *DFXService) importIdentityIfNeeded(identity string, pemFile string) error {
+	s.log.Infof("Importing identity %s from %s...", identity, pemFile)
+	pemPath, err := filepath.Abs(pemFile)
+	if err != nil {
+		return err
+	}
+	output, exitCode, err := s.runDfx([]string{"identity", "import", identity, pemPath}, true)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not import identity", identity)
 		return err
 	}
+	if exitCode != 0 && !strings.Contains(output, "Identity already exists.") {
+		s.log.Errorln("Could not import identity", identity+":", output)
+		return fmt.Errorf("Could not import identity %s: %v", identity, output)
+	}
 	return nil
 }
 
 func (s *DFXService) doesCanisterExist() (bool, error) {
 	s.log.Infof("Checking if canister already exists...")
-	output, exitCode, err := dfxCall(s.config.CanisterName, []string{"canister", "id", s.config.CanisterName}, true)
+	output, exitCode, err := s.runDfx(s.canisterArgs("id", s.config.CanisterName), true)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not determine if canister exists")
 		return false, err
@@ -113,29 +228,41 @@ func (s *DFXService) doesCanisterExist() (bool, error) {
 	}
 	if !strings.HasPrefix(output, "Cannot find canister id.") {
 		s.log.Errorln("Could not determine if canister exists:", output)
-		return false, err
+		return false, fmt.Errorf("Could not determine if canister exists: %v", output)
 	}
 	return false, nil
 }
 
 func (s *DFXService) isCanisterRunning() (bool, error) {
 	s.log.Infof("Checking if canister is running...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"canister", "status", s.config.CanisterName}, false)
+	running, _, err := s.canisterStateContext(context.Background())
+	return running, err
+}
+
+// canisterStateContext returns whether the canister is running, and whether code is installed in it according to the
+// module hash that `dfx canister status` reports
+func (s *DFXService) canisterStateContext(ctx context.Context) (running bool, installed bool, err error) {
+	output, _, err := s.runDfxContext(ctx, s.canisterArgs("status", s.config.CanisterName), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not determine canister status:", output)
-		return false, err
+		return false, false, err
 	}
 	if !strings.HasPrefix(output, "Canister "+s.config.CanisterName+"'s status is ") {
 		s.log.WithError(err).Errorln("Could not determine canister status:", output)
-		return false, fmt.Errorf("Could not determine canister status: %v", output)
+		return false, false, fmt.Errorf("Could not determine canister status: %v", output)
+	}
+	running = strings.HasPrefix(output, "Canister "+s.config.CanisterName+"'s status is Running.")
+	for _, line := range strings.Split(output, "\n") {
+		if hash := strings.TrimPrefix(line, "Module hash: "); hash != line {
+			installed = strings.TrimSpace(hash) != "None"
+		}
 	}
-	isRunning := strings.HasPrefix(output, "Canister "+s.config.CanisterName+"'s status is Running.")
-	return isRunning, nil
+	return running, installed, nil
 }
 
 func (s *DFXService) createCanister() error {
 	s.log.Infof("Creating canister...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"canister", "create", s.config.CanisterName}, false)
+	output, _, err := s.runDfx(s.canisterArgs("create", s.config.CanisterName), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not create canister:", output)
 		return err
@@ -145,7 +272,7 @@ func (s *DFXService) createCanister() error {
 
 func (s *DFXService) buildCanister() error {
 	s.log.Infof("Building canister...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"build", s.config.CanisterName}, false)
+	output, _, err := s.runDfx(s.networkArgs("build", s.config.CanisterName), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not build canister:", output)
 		return err
@@ -156,12 +283,12 @@ func (s *DFXService) buildCanister() error {
 func (s *DFXService) installCanister(upgradeExistingCanister bool) error {
 	s.log.Infof("Installing canister...")
 
-	args := []string{"canister", "install", s.config.CanisterName}
+	args := s.canisterArgs("install", s.config.CanisterName)
 	if upgradeExistingCanister {
-		args = []string{"canister", "install", s.config.CanisterName, "--mode", "upgrade"}
+		args = s.canisterArgs("install", s.config.CanisterName, "--mode", "upgrade")
 	}
 
-	output, _, err := dfxCall(s.config.CanisterName, args, false)
+	output, _, err := s.runDfx(args, false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not install canister:", output)
 		return err
@@ -171,7 +298,7 @@ func (s *DFXService) installCanister(upgradeExistingCanister bool) error {
 
 func (s *DFXService) startCanister() error {
 	s.log.Infof("Starting canister...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"canister", "start", s.config.CanisterName}, false)
+	output, _, err := s.runDfx(s.canisterArgs("start", s.config.CanisterName), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not start canister:", output)
 		return err
@@ -181,7 +308,7 @@ func (s *DFXService) startCanister() error {
 
 func (s *DFXService) checkIsOwner() (bool, error) {
 	s.log.Infof("Checking if we have the owner role...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"canister", "call", s.config.CanisterName, "my_role"}, false)
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "my_role"), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not retrieve current role:", output)
 		return false, err
@@ -192,7 +319,7 @@ func (s *DFXService) checkIsOwner() (bool, error) {
 
 func (s *DFXService) assignOwnerRole() error {
 	s.log.Infof("Assigning owner role to owner identity...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"canister", "call", s.config.CanisterName, "assign_owner_role"}, false)
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "assign_owner_role"), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not assign owner role to the owner identity:", output)
 		return err
@@ -201,19 +328,136 @@ func (s *DFXService) assignOwnerRole() error {
 }
 
 func (s *DFXService) getWriterIDPrincipal() (string, error) {
-	s.log.Infof("Retrieving writer ID principal...")
-	output, _, err := dfxCall(s.config.CanisterName, []string{"--identity", "writer", "identity", "get-principal"}, false)
+	return s.getIdentityPrincipal(s.currentWriterIdentity())
+}
+
+func (s *DFXService) getIdentityPrincipal(identity string) (string, error) {
+	s.log.Infof("Retrieving principal of identity %s...", identity)
+	output, _, err := s.runDfx([]string{"--identity", identity, "identity", "get-principal"}, false)
 	if err != nil {
-		s.log.WithError(err).Errorln("Could not determine the writer identity's principal:", output)
+		s.log.WithError(err).Errorln("Could not determine the principal of identity", identity+":", output)
 		return "", err
 	}
 	return strings.TrimSpace(output), nil
 }
 
+func (s *DFXService) currentWriterIdentity() string {
+	s.writerMu.RLock()
+	defer s.writerMu.RUnlock()
+	return s.writerIdentity
+}
+
+// loadWriterIdentity returns the writer identity recorded in writerStateFile, or an empty string if the writer of this
+// network and canister has never been rotated
+func (s *DFXService) loadWriterIdentity() (string, error) {
+	path := filepath.Join(s.projectDir(), writerStateFile)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var state writerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return "", fmt.Errorf("Could not parse %s: %w", path, err)
+	}
+	if state.Target != s.target() {
+		return "", nil
+	}
+	return state.Identity, nil
+}
+
+// saveWriterIdentity records the given identity in writerStateFile, replacing the file at once so that other processes
+// never read a partial record
+func (s *DFXService) saveWriterIdentity(identity string) error {
+	data, err := json.MarshalIndent(writerState{Target: s.target(), Identity: identity}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.projectDir(), 0755); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(s.projectDir(), writerStateFile)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filepath.Join(s.projectDir(), writerStateFile))
+}
+
+// refreshWriterIdentity switches to the writer identity recorded in writerStateFile if another process has rotated the
+// writer, returning whether the identity changed
+func (s *DFXService) refreshWriterIdentity() bool {
+	identity, err := s.loadWriterIdentity()
+	if err != nil {
+		s.log.WithError(err).Warnln("Could not load the rotated writer identity, keeping", s.currentWriterIdentity())
+		return false
+	}
+	if identity == "" {
+		return false
+	}
+	s.writerMu.Lock()
+	defer s.writerMu.Unlock()
+	if identity == s.writerIdentity {
+		return false
+	}
+	s.log.Infof("Switched writer identity from %s to rotated writer %s", s.writerIdentity, identity)
+	s.writerIdentity = identity
+	return true
+}
+
+// rotateWriter makes the given identity the writer, creating it if needed, then revokes the writer role of the
+// previous writer identity. The new identity is recorded in the project directory, so that an oracle running in
+// another process switches to it before its next write, and later processes start with it. Writes in progress finish
+// with the previous identity before the switch, and later writes use the new one, so writing is never interrupted.
+func (s *DFXService) rotateWriter(newIdentity string) error {
+	s.refreshWriterIdentity()
+	oldIdentity := s.currentWriterIdentity()
+	if newIdentity == oldIdentity {
+		return fmt.Errorf("Identity %s is already the writer", newIdentity)
+	}
+	oldPrincipal, err := s.getIdentityPrincipal(oldIdentity)
+	if err != nil {
+		return err
+	}
+	if err := s.createIdentityIfNeeded(newIdentity); err != nil {
+		return err
+	}
+	newPrincipal, err := s.getIdentityPrincipal(newIdentity)
+	if err != nil {
+		return err
+	}
+	if err := s.assignWriterRole(newPrincipal); err != nil {
+		return err
+	}
+	if err := s.saveWriterIdentity(newIdentity); err != nil {
+		s.log.WithError(err).Errorln("Could not record the writer identity", newIdentity)
+		return fmt.Errorf("Assigned the writer role to %s, but could not record it as the writer, so the writer role of %s was not revoked: %w", newIdentity, oldIdentity, err)
+	}
+
+	s.writerMu.Lock()
+	s.writerIdentity = newIdentity
+	s.writerMu.Unlock()
+	s.log.Infof("Switched writer identity from %s to %s", oldIdentity, newIdentity)
+
+	if err := s.revokeWriterRole(oldPrincipal); err != nil {
+		return fmt.Errorf("Switched to writer %s, but could not revoke the writer role of %s: %w", newIdentity, oldPrincipal, err)
+	}
+	return nil
+}
+
 func (s *DFXService) assignWriterRole(writerPrincipal string) error {
 	s.log.Infof("Assigning writer role to writer identity %s...", writerPrincipal)
 	callArgs := fmt.Sprintf("(%v)", utils.CandidPrincipal(writerPrincipal))
-	output, _, err := dfxCall(s.config.CanisterName, []string{"canister", "call", s.config.CanisterName, "assign_writer_role", callArgs}, false)
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "assign_writer_role", callArgs), false)
 	if err != nil {
 		s.log.WithError(err).Errorln("Could not assign writer role to the writer identity:", output)
 		return err
@@ -221,12 +465,20 @@ func (s *DFXService) assignWriterRole(writerPrincipal string) error {
 	return nil
 }
 
-func (s *DFXService) updateValueInCanister(key string, val map[string]float64) error {
+func (s *DFXService) updateValueInCanister(ctx context.Context, key string, val map[string]float64) error {
 	s.log.Infof("Updating value in canister...")
+	s.refreshWriterIdentity()
 
 	for k, v := range val {
-		callArgs := fmt.Sprintf("(%v,%v,%v)", utils.CandidText(key), utils.CandidText(k), utils.CandidFloat64(v))
-		output, _, err := dfxCall(s.config.CanisterName, []string{"--identity", "writer", "canister", "call", s.config.CanisterName, "update_map_value", callArgs}, false)
+		if err := ctx.Err(); err != nil {
+			s.log.WithError(err).Errorln("Aborted updating key", key, "in canister")
+			return err
+		}
+		output, err := s.updateFieldInCanister(ctx, key, k, v)
+		if err != nil && s.refreshWriterIdentity() {
+			// another process rotated the writer and revoked the previous identity while it was writing
+			output, err = s.updateFieldInCanister(ctx, key, k, v)
+		}
 		if err != nil {
 			s.log.WithError(err).Errorln("Could not update key", key, "field", k, "value", val, "in canister:", output)
 			return err
@@ -235,17 +487,154 @@ func (s *DFXService) updateValueInCanister(key string, val map[string]float64) e
 	return nil
 }
 
+// updateFieldInCanister writes a single field of a key to the canister with the current writer identity
+func (s *DFXService) updateFieldInCanister(ctx context.Context, key string, field string, value float64) (string, error) {
+	s.writerMu.RLock()
+	defer s.writerMu.RUnlock()
+	callArgs := fmt.Sprintf("(%v,%v,%v)", utils.CandidText(key), utils.CandidText(field), utils.CandidFloat64(value))
+	output, _, err := s.runDfxContext(ctx, s.identityCanisterArgs(s.writerIdentity, "call", s.config.CanisterName, "update_map_value", callArgs), false)
+	return output, err
+}
+
+func (s *DFXService) revokeWriterRole(writerPrincipal string) error {
+	s.log.Infof("Revoking writer role from %s...", writerPrincipal)
+	callArgs := fmt.Sprintf("(%v)", utils.CandidPrincipal(writerPrincipal))
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "revoke_writer_role", callArgs), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not revoke writer role:", output)
+		return err
+	}
+	return nil
+}
+
+func (s *DFXService) getRoles() (string, error) {
+	s.log.Infof("Retrieving canister roles...")
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "get_roles"), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not retrieve canister roles:", output)
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (s *DFXService) getMyRole() (string, error) {
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "my_role"), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not retrieve current role:", output)
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// hasWriterRole checks whether the writer identity has the writer role in the canister
+func (s *DFXService) hasWriterRole(ctx context.Context) (bool, error) {
+	s.refreshWriterIdentity()
+	identity := s.currentWriterIdentity()
+	output, _, err := s.runDfxContext(ctx, s.identityCanisterArgs(identity, "call", s.config.CanisterName, "my_role"), false)
+	if err != nil {
+		return false, fmt.Errorf("Could not retrieve role of %s: %w", identity, err)
+	}
+	values, err := utils.ParseCandid(output)
+	if err != nil || len(values) != 1 {
+		return false, fmt.Errorf("Could not parse role of %s: %v", identity, output)
+	}
+	if role, ok := values[0].(utils.CandidOpt); ok {
+		variant, ok := role.Value.(utils.CandidVariant)
+		return ok && variant.Name == "writer", nil
+	}
+	return false, nil
+}
+
+func (s *DFXService) getCanisterStatus() (string, error) {
+	output, _, err := s.runDfx(s.canisterArgs("status", s.config.CanisterName), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not determine canister status:", output)
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (s *DFXService) getMapValue(key string) (string, error) {
+	callArgs := fmt.Sprintf("(%v)", utils.CandidText(key))
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "get_map_value", callArgs), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not retrieve key", key, "from canister:", output)
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (s *DFXService) getMapFieldValue(key string, field string) (string, error) {
+	callArgs := fmt.Sprintf("(%v,%v)", utils.CandidText(key), utils.CandidText(field))
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "get_map_field_value", callArgs), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not retrieve key", key, "field", field, "from canister:", output)
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (s *DFXService) selfDestruct() error {
+	s.log.Warnf("Self-destructing canister %s...", s.config.CanisterName)
+	output, _, err := s.runDfx(s.canisterArgs("call", s.config.CanisterName, "self_destruct"), false)
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not self-destruct canister:", output)
+		return err
+	}
+	return nil
+}
+
+// canisterArgs returns the arguments for the given `dfx canister` subcommand, run as the owner identity and targeting
+// the configured network
+func (s *DFXService) canisterArgs(args ...string) []string {
+	return s.identityCanisterArgs(s.config.OwnerIdentity, args...)
+}
+
+// identityCanisterArgs returns the arguments for the given `dfx canister` subcommand, run as the given identity (or the
+// currently selected one, if empty) and targeting the configured network
+func (s *DFXService) identityCanisterArgs(identity string, args ...string) []string {
+	command := s.networkArgs("canister", args...)
+	if identity == "" {
+		return command
+	}
+	return append([]string{"--identity", identity}, command...)
+}
+
+// networkArgs returns the arguments for the given DFX command, targeting the configured network
+func (s *DFXService) networkArgs(command string, args ...string) []string {
+	result := []string{command}
+	if s.config.Network != "" {
+		result = append(result, "--network", s.config.Network)
+	}
+	return append(result, args...)
+}
+
+// runDfx runs a DFX command in the project directory, recording its duration and whether it failed
+func (s *DFXService) runDfx(args []string, allowNonzeroExitCode bool) (string, int, error) {
+	return s.runDfxContext(context.Background(), args, allowNonzeroExitCode)
+}
+
+// runDfxContext is like runDfx, but kills the DFX process if the given context is cancelled before it exits
+func (s *DFXService) runDfxContext(ctx context.Context, args []string, allowNonzeroExitCode bool) (string, int, error) {
+	start := time.Now()
+	output, exitCode, err := dfxCallContext(ctx, s.projectDir(), args, allowNonzeroExitCode)
+	s.metrics.observeDfxCall(args, time.Since(start), err)
+	return output, exitCode, err
+}
+
 func dfxCall(workingDir string, args []string, allowNonzeroExitCode bool) (string, int, error) {
+	return dfxCallContext(context.Background(), workingDir, args, allowNonzeroExitCode)
+}
+
+// dfxCallContext is like dfxCall, but kills the DFX process if the given context is cancelled before it exits
+func dfxCallContext(ctx context.Context, workingDir string, args []string, allowNonzeroExitCode bool) (string, int, error) {
 	dfxExecutable, err := exec.LookPath("dfx")
 	if err != nil {
 		return "", 0, fmt.Errorf("Could not find DFX executable: %w", err)
 	}
 
-	dfxCommand := &exec.Cmd{
-		Path: dfxExecutable,
-		Dir:  workingDir,
-		Args: append([]string{dfxExecutable}, args...),
-	}
+	dfxCommand := exec.CommandContext(ctx, dfxExecutable, args...)
+	dfxCommand.Dir = workingDir
 	output, err := dfxCommand.CombinedOutput()
 	if err != nil {
 		if allowNonzeroExitCode {
@@ -0,0 +1,260 @@
+package framework
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeDfx puts a shell script named dfx with the given body first in PATH, returning a function that restores PATH;
+// the script runs in a directory it can use to keep state between calls, which is also returned
+func fakeDfx(t *testing.T, body string) (string, func()) {
+	dir, err := ioutil.TempDir("", "fake-dfx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncd " + dir + "\n" + body + "\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "dfx"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	return dir, func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestDFXService(config *models.Config) *DFXService {
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	return NewDFXService(config, log)
+}
+
+func TestStartDfxNetworkIfNeededPollsUntilReady(t *testing.T) {
+	// the replica becomes healthy on the third ping after being started
+	_, restore := fakeDfx(t, `echo "$@" >> calls
+case "$1" in
+start) echo 0 > pings ;;
+ping) [ -f pings ] || exit 1; n=$(($(cat pings) + 1)); echo $n > pings; [ $n -ge 3 ] ;;
+esac`)
+	defer restore()
+
+	s := newTestDFXService(&models.Config{CanisterName: ".", ReplicaReadyTimeout: 5 * time.Second})
+	if err := s.startDfxNetworkIfNeeded(); err != nil {
+		t.Fatalf("Expected the network to start, got %v", err)
+	}
+}
+
+func TestStartDfxNetworkIfNeededUsesRunningReplica(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$1" >> calls`)
+	defer restore()
+
+	s := newTestDFXService(&models.Config{CanisterName: ".", UnmanagedReplica: true})
+	if err := s.startDfxNetworkIfNeeded(); err != nil {
+		t.Fatalf("Expected the running replica to be used, got %v", err)
+	}
+
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	if string(calls) != "ping\n" {
+		t.Errorf("Expected only a ping, got calls %q", calls)
+	}
+}
+
+func TestStartDfxNetworkIfNeededRespectsUnmanagedReplica(t *testing.T) {
+	_, restore := fakeDfx(t, `exit 1`)
+	defer restore()
+
+	s := newTestDFXService(&models.Config{CanisterName: ".", UnmanagedReplica: true})
+	if err := s.startDfxNetworkIfNeeded(); err == nil {
+		t.Errorf("Expected an error when no replica is running and management is disabled")
+	}
+}
+
+func TestWaitForReplicaTimesOut(t *testing.T) {
+	_, restore := fakeDfx(t, `exit 1`)
+	defer restore()
+
+	s := newTestDFXService(&models.Config{CanisterName: ".", ReplicaReadyTimeout: 100 * time.Millisecond})
+	if err := s.waitForReplica(); err == nil {
+		t.Errorf("Expected a timeout error")
+	}
+}
+
+func TestCommandsTargetConfiguredNetwork(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls`)
+	defer restore()
+
+	s := newTestDFXService(&models.Config{CanisterName: ".", Network: "ic"})
+	s.getRoles()
+	s.buildCanister()
+	s.updateValueInCanister(context.Background(), "k", map[string]float64{"f": 1})
+	s.isReplicaHealthy()
+
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	expected := `canister --network ic call . get_roles
+build --network ic .
+--identity writer canister --network ic call . update_map_value ("k","f",1.000000)
+ping ic
+`
+	if string(calls) != expected {
+		t.Errorf("Incorrect DFX calls, expected:\n%s\ngot:\n%s", expected, calls)
+	}
+}
+
+func TestDestructiveOperationsOnMainnetRequireConfirmation(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls`)
+	defer restore()
+
+	config := &models.Config{CanisterName: ".", Network: models.MainnetNetwork}
+	o := newTestOracle(t, config, &models.Engine{})
+	if err := o.SelfDestruct(); err != ErrMainnetConfirmationRequired {
+		t.Errorf("Expected self-destruct to require confirmation, got %v", err)
+	}
+	if err := o.RevokeWriter("aaaaa-aa"); err != ErrMainnetConfirmationRequired {
+		t.Errorf("Expected revoking a writer to require confirmation, got %v", err)
+	}
+	if err := o.RotateWriter("writer-2"); err != ErrMainnetConfirmationRequired {
+		t.Errorf("Expected rotating the writer to require confirmation, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "calls")); err == nil {
+		t.Errorf("Expected no DFX calls without confirmation")
+	}
+
+	if err := o.RevokeWriter("aaaaa-aa", ConfirmMainnet()); err != nil {
+		t.Errorf("Expected revoking a writer to succeed when confirmed, got %v", err)
+	}
+	if err := o.SelfDestruct(); err != ErrMainnetConfirmationRequired {
+		t.Errorf("Expected confirming one operation not to allow another, got %v", err)
+	}
+
+	config.AllowMainnetDestructiveOperations = true
+	if err := o.SelfDestruct(); err != nil {
+		t.Errorf("Expected self-destruct to succeed with confirmation, got %v", err)
+	}
+}
+
+func TestMainnetProvidersAreMainnet(t *testing.T) {
+	mainnet := []*models.Config{
+		{Network: "ic"},
+		{Network: "https://ic0.app"},
+		{Network: "https://icp0.io/"},
+		{Network: "https://ICP-API.io"},
+		{Network: "https://boundary.ic0.app"},
+		{Network: "prod", Networks: map[string]string{"prod": "https://icp0.io"}},
+	}
+	for _, config := range mainnet {
+		if !config.IsMainnet() {
+			t.Errorf("Expected %s %v to be mainnet", config.Network, config.Networks)
+		}
+		o := newTestOracle(t, &models.Config{CanisterName: ".", Network: config.Network, Networks: config.Networks}, &models.Engine{})
+		if err := o.SelfDestruct(); err != ErrMainnetConfirmationRequired {
+			t.Errorf("Expected self-destruct on %s to require confirmation, got %v", config.Network, err)
+		}
+	}
+	other := []*models.Config{
+		{},
+		{Network: "local"},
+		{Network: "http://127.0.0.1:4943"},
+		{Network: "https://ic0.app.example.com"},
+		{Network: "staging", Networks: map[string]string{"staging": "https://staging.example.com"}},
+	}
+	for _, config := range other {
+		if config.IsMainnet() {
+			t.Errorf("Expected %s %v not to be mainnet", config.Network, config.Networks)
+		}
+	}
+}
+
+func TestNetworksFromDfxJSONAreResolved(t *testing.T) {
+	_, restore := fakeDfx(t, `echo "$@" >> calls`)
+	defer restore()
+	dir := tempDir(t)
+	dfxJSON := `{"networks": {
+		"prod": {"providers": ["https://icp0.io"], "type": "persistent"},
+		"staging": {"providers": ["https://staging.example.com"], "type": "persistent"},
+		"dev": {"bind": "127.0.0.1:4943", "type": "ephemeral"}
+	}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "dfx.json"), []byte(dfxJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for network, mainnet := range map[string]bool{"prod": true, "unknown": true, "staging": false, "dev": false} {
+		if !(&models.Config{Network: network}).IsMainnet() {
+			t.Errorf("Expected %s to be treated as mainnet without the project's networks", network)
+		}
+		o := newTestOracle(t, &models.Config{CanisterName: "test", ProjectDir: dir, Network: network}, &models.Engine{})
+		err := o.SelfDestruct()
+		if mainnet && err != ErrMainnetConfirmationRequired {
+			t.Errorf("Expected self-destruct on %s to require confirmation, got %v", network, err)
+		}
+		if !mainnet && err == ErrMainnetConfirmationRequired {
+			t.Errorf("Expected self-destruct on %s not to require confirmation", network)
+		}
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls
+[ "$4" = "get-principal" ] && echo "principal-$2"
+exit 0`)
+	defer restore()
+
+	s := newTestDFXService(&models.Config{CanisterName: ".", ProjectDir: dir, OwnerIdentity: "owner", WriterIdentity: "writer-1"})
+	if err := s.rotateWriter("writer-2"); err != nil {
+		t.Fatalf("Could not rotate writer: %v", err)
+	}
+	s.updateValueInCanister(context.Background(), "k", map[string]float64{"f": 1})
+
+	calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls"))
+	expected := `--identity writer-1 identity get-principal
+identity new writer-2
+--identity writer-2 identity get-principal
+--identity owner canister call . assign_writer_role (principal "principal-writer-2")
+--identity owner canister call . revoke_writer_role (principal "principal-writer-1")
+--identity writer-2 canister call . update_map_value ("k","f",1.000000)
+`
+	if string(calls) != expected {
+		t.Errorf("Incorrect DFX calls, expected:\n%s\ngot:\n%s", expected, calls)
+	}
+}
+
+func TestRotateWriterInAnotherProcess(t *testing.T) {
+	// writes fail once the principal of the writer identity has been revoked
+	dir, restore := fakeDfx(t, `case "$*" in
+*get-principal*) echo "principal-$2" ;;
+*revoke_writer_role*) echo "$7" >> revoked ;;
+*update_map_value*) grep -q "principal-$2\"" revoked 2>/dev/null && exit 1 ;;
+esac
+exit 0`)
+	defer restore()
+	config := &models.Config{CanisterName: ".", ProjectDir: dir, OwnerIdentity: "owner", WriterIdentity: "writer-1"}
+	running := newTestDFXService(config)
+	if err := running.updateValueInCanister(context.Background(), "k", map[string]float64{"f": 1}); err != nil {
+		t.Fatalf("Could not write before rotating: %v", err)
+	}
+
+	if err := newTestDFXService(config).rotateWriter("writer-2"); err != nil {
+		t.Fatalf("Could not rotate writer: %v", err)
+	}
+
+	if err := running.updateValueInCanister(context.Background(), "k", map[string]float64{"f": 2}); err != nil {
+		t.Errorf("Expected the running service to keep writing after the rotation, got %v", err)
+	}
+	if identity := running.currentWriterIdentity(); identity != "writer-2" {
+		t.Errorf("Expected the running service to switch to the rotated writer, got %s", identity)
+	}
+	if identity := newTestDFXService(config).currentWriterIdentity(); identity != "writer-2" {
+		t.Errorf("Expected a restarted service to keep the rotated writer, got %s", identity)
+	}
+	other := &models.Config{CanisterName: ".", ProjectDir: dir, Network: "ic", WriterIdentity: "writer-1"}
+	if identity := newTestDFXService(other).currentWriterIdentity(); identity != "writer-1" {
+		t.Errorf("Expected the rotation not to apply to another network, got %s", identity)
+	}
+}
@@ -0,0 +1,533 @@
+// Package expr implements a small, safe arithmetic expression language for computing oracle values.
+//
+// Expressions support numbers, the arithmetic operators + - * /, the comparison operators < <= > >= == != and the
+// logical operators && || ! (which produce 1 for true and 0 for false), parentheses, calls to the functions listed in
+// Functions, and variable references. A variable is an identifier optionally followed by dotted field names (e.g.
+// "price" or "ETH.price"); names that are not identifiers can be written in square brackets (e.g. "[ETH/USD].price").
+//
+// The conditional if(condition, then, else) only evaluates the branch that is selected.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled expression
+type Expr struct {
+	source string
+	root   node
+	vars   []string
+}
+
+// Compile parses the given expression source
+func Compile(source string) (*Expr, error) {
+	p := &parser{source: source}
+	p.next()
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	seen := make(map[string]bool)
+	collectVars(root, seen)
+	vars := make([]string, 0, len(seen))
+	for name := range seen {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	return &Expr{source: source, root: root, vars: vars}, nil
+}
+
+// MustCompile is like Compile, but panics if the expression cannot be parsed
+func MustCompile(source string) *Expr {
+	e, err := Compile(source)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Vars returns the sorted names of every variable referenced by the expression
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// SplitVar splits a variable name such as "ETH/USD.price" at its last dot, into the name it is qualified by and a
+// field name, returning false if the variable is not qualified
+func SplitVar(name string) (string, string, bool) {
+	i := strings.LastIndex(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", false
+	}
+	return name[:i], name[i+1:], true
+}
+
+// Eval evaluates the expression with the given variable values
+func (e *Expr) Eval(vars map[string]float64) (float64, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return 0, fmt.Errorf("evaluating %q: %w", e.source, err)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("evaluating %q: result %v is not a finite number", e.source, value)
+	}
+	return value, nil
+}
+
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+type varNode string
+
+func (n varNode) eval(vars map[string]float64) (float64, error) {
+	value, ok := vars[string(n)]
+	if !ok {
+		return 0, fmt.Errorf("no value for %s", string(n))
+	}
+	return value, nil
+}
+
+type unaryNode struct {
+	op      byte
+	operand node
+}
+
+func (n *unaryNode) eval(vars map[string]float64) (float64, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	if n.op == '!' {
+		return boolValue(value == 0), nil
+	}
+	return -value, nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(vars map[string]float64) (float64, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	// logical operators short-circuit
+	if n.op == "&&" && left == 0 {
+		return 0, nil
+	}
+	if n.op == "||" && left != 0 {
+		return 1, nil
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	case "<":
+		return boolValue(left < right), nil
+	case "<=":
+		return boolValue(left <= right), nil
+	case ">":
+		return boolValue(left > right), nil
+	case ">=":
+		return boolValue(left >= right), nil
+	case "==":
+		return boolValue(left == right), nil
+	case "!=":
+		return boolValue(left != right), nil
+	case "&&", "||":
+		return boolValue(right != 0), nil
+	}
+	return 0, fmt.Errorf("unknown operator %s", n.op)
+}
+
+type callNode struct {
+	name string
+	fn   Function
+	args []node
+}
+
+func (n *callNode) eval(vars map[string]float64) (float64, error) {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = value
+	}
+	value, err := n.fn.Call(args)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", n.name, err)
+	}
+	return value, nil
+}
+
+type conditionalNode struct {
+	condition, then, otherwise node
+}
+
+func (n *conditionalNode) eval(vars map[string]float64) (float64, error) {
+	condition, err := n.condition.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	if condition != 0 {
+		return n.then.eval(vars)
+	}
+	return n.otherwise.eval(vars)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func collectVars(n node, vars map[string]bool) {
+	switch n := n.(type) {
+	case varNode:
+		vars[string(n)] = true
+	case *unaryNode:
+		collectVars(n.operand, vars)
+	case *binaryNode:
+		collectVars(n.left, vars)
+		collectVars(n.right, vars)
+	case *callNode:
+		for _, arg := range n.args {
+			collectVars(arg, vars)
+		}
+	case *conditionalNode:
+		collectVars(n.condition, vars)
+		collectVars(n.then, vars)
+		collectVars(n.otherwise, vars)
+	}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokVar
+	tokOp
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	value float64
+	pos   int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	source string
+	pos    int
+	tok    token
+	err    error
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q at offset %d: %s", p.source, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next advances to the next token, recording the first lexing error encountered
+func (p *parser) next() {
+	for p.pos < len(p.source) && unicode.IsSpace(rune(p.source[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+
+	c := p.source[p.pos]
+	switch {
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.source) && (isDigit(p.source[p.pos]) || p.source[p.pos] == '.') {
+			p.pos++
+		}
+		if p.pos < len(p.source) && (p.source[p.pos] == 'e' || p.source[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.source) && (p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.source) && isDigit(p.source[p.pos]) {
+				p.pos++
+			}
+		}
+		text := p.source[start:p.pos]
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil && p.err == nil {
+			p.err = fmt.Errorf("expression %q at offset %d: invalid number %q", p.source, start, text)
+		}
+		p.tok = token{kind: tokNumber, text: text, value: value, pos: start}
+	case isIdentStart(c) || c == '[':
+		var name strings.Builder
+		for {
+			part, ok := p.lexName()
+			if !ok {
+				break
+			}
+			name.WriteString(part)
+			if p.pos < len(p.source) && p.source[p.pos] == '.' {
+				p.pos++
+				name.WriteByte('.')
+				continue
+			}
+			break
+		}
+		p.tok = token{kind: tokVar, text: name.String(), pos: start}
+	default:
+		p.pos++
+		if p.pos < len(p.source) {
+			switch twoChars := p.source[start : p.pos+1]; twoChars {
+			case "<=", ">=", "==", "!=", "&&", "||":
+				p.pos++
+				p.tok = token{kind: tokOp, text: twoChars, pos: start}
+				return
+			}
+		}
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	}
+}
+
+// lexName lexes a single identifier or bracketed name of a variable reference
+func (p *parser) lexName() (string, bool) {
+	start := p.pos
+	if p.pos < len(p.source) && p.source[p.pos] == '[' {
+		end := strings.IndexByte(p.source[p.pos:], ']')
+		if end < 0 {
+			if p.err == nil {
+				p.err = fmt.Errorf("expression %q at offset %d: unterminated [", p.source, start)
+			}
+			p.pos = len(p.source)
+			return "", false
+		}
+		p.pos += end + 1
+		return p.source[start+1 : p.pos-1], true
+	}
+	if p.pos >= len(p.source) || !isIdentStart(p.source[p.pos]) {
+		return "", false
+	}
+	for p.pos < len(p.source) && isIdentPart(p.source[p.pos]) {
+		p.pos++
+	}
+	return p.source[start:p.pos], true
+}
+
+// parseExpr parses logical or expressions, the lowest precedence level
+func (p *parser) parseExpr() (node, error) {
+	return p.parseBinary(0)
+}
+
+// binaryLevels lists the binary operators from lowest to highest precedence
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"<", "<=", ">", ">=", "==", "!="},
+}
+
+func (p *parser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseAdditive()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(binaryLevels[level]...) {
+		op := p.tok.text
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "-") {
+		op := p.tok.text
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "/") {
+		op := p.tok.text
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("-", "!") {
+		op := p.tok.text[0]
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		p.next()
+		return numberNode(tok.value), nil
+	case tok.kind == tokVar:
+		if tok.text == "" || strings.HasSuffix(tok.text, ".") {
+			return nil, p.errorf("incomplete variable reference %q", tok.text)
+		}
+		p.next()
+		if p.isOp("(") {
+			return p.parseCall(tok)
+		}
+		return varNode(tok.text), nil
+	case tok.kind == tokOp && tok.text == "(":
+		p.next()
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokOp || p.tok.text != ")" {
+			return nil, p.errorf("expected \")\", got %s", p.tok)
+		}
+		p.next()
+		return inner, nil
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+// parseCall parses the arguments of a call to the function named by the given token, which is followed by "("
+func (p *parser) parseCall(name token) (node, error) {
+	p.next()
+	var args []node
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if !p.isOp(",") {
+				return nil, p.errorf("expected \",\" or \")\", got %s", p.tok)
+			}
+			p.next()
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	if name.text == "if" {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("expression %q at offset %d: if takes 3 arguments, got %d", p.source, name.pos, len(args))
+		}
+		return &conditionalNode{condition: args[0], then: args[1], otherwise: args[2]}, nil
+	}
+	fn, ok := Functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("expression %q at offset %d: unknown function %s", p.source, name.pos, name.text)
+	}
+	if len(args) < fn.MinArgs || (fn.MaxArgs >= 0 && len(args) > fn.MaxArgs) {
+		return nil, fmt.Errorf("expression %q at offset %d: wrong number of arguments to %s: %d", p.source, name.pos, name.text, len(args))
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
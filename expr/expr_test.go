@@ -0,0 +1,66 @@
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{"ETH/USD.price": 3000, "BTC.price": 60000, "x": 2}
+	cases := map[string]float64{
+		"1 + 2 * 3":                       7,
+		"(1 + 2) * 3":                     9,
+		"-x - -1":                         -1,
+		"1.5e3 / 3":                       500,
+		"[ETH/USD].price / BTC.price":     0.05,
+		"[ETH/USD].price / BTC.price * 2": 0.1,
+		"(x + 8) / 2":                     5,
+		"min(3, x, 5) + max(1, 4)":        6,
+		"f_to_c(212)":                     100,
+		"from_decimals(2500000, 6)":       2.5,
+		"round(1.23456, 2)":               1.23,
+		"if(x > 1 && !(x == 3), 10, 1/0)": 10,
+		"if(x >= 5 || x != 2, 1/0, 20)":   20,
+		"x < 1 || x <= 2":                 1,
+	}
+	for source, expected := range cases {
+		e, err := Compile(source)
+		if err != nil {
+			t.Errorf("Could not compile %q: %v", source, err)
+			continue
+		}
+		result, err := e.Eval(vars)
+		if err != nil {
+			t.Errorf("Could not evaluate %q: %v", source, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("Incorrect result for %q, expected %v, got %v", source, expected, result)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	e := MustCompile("[ETH/USD].price / BTC.price + BTC.price")
+
+	expected := []string{"BTC.price", "ETH/USD.price"}
+	if !reflect.DeepEqual(e.Vars(), expected) {
+		t.Errorf("Incorrect variables, expected %v, got %v", expected, e.Vars())
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, source := range []string{"", "1 +", "(1", "1 2", "[ETH", "x.", "1.2.3", "$", "nope(1)", "if(1, 2)", "abs(1, 2)", "min(1,"} {
+		if _, err := Compile(source); err == nil {
+			t.Errorf("Expected an error compiling %q", source)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, source := range []string{"1 / 0", "missing + 1"} {
+		if _, err := MustCompile(source).Eval(map[string]float64{}); err == nil {
+			t.Errorf("Expected an error evaluating %q", source)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+)
+
+// Function is a function that can be called from expressions
+type Function struct {
+	MinArgs int
+	MaxArgs int // -1 for any number of arguments
+	Call    func(args []float64) (float64, error)
+}
+
+// Functions are the functions available to expressions, in addition to if(condition, then, else)
+var Functions = map[string]Function{
+	"min":   {1, -1, minOf},
+	"max":   {1, -1, maxOf},
+	"abs":   unary(math.Abs),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": {1, 2, roundTo},
+	"sqrt":  unary(math.Sqrt),
+	"pow":   {2, 2, func(args []float64) (float64, error) { return math.Pow(args[0], args[1]), nil }},
+	"clamp": {3, 3, func(args []float64) (float64, error) { return math.Min(math.Max(args[0], args[1]), args[2]), nil }},
+
+	// unit conversions
+	"f_to_c":      unary(func(f float64) float64 { return (f - 32) * 5 / 9 }),
+	"c_to_f":      unary(func(c float64) float64 { return c*9/5 + 32 }),
+	"k_to_c":      unary(func(k float64) float64 { return k - 273.15 }),
+	"c_to_k":      unary(func(c float64) float64 { return c + 273.15 }),
+	"mph_to_kph":  unary(func(mph float64) float64 { return mph * 1.609344 }),
+	"kph_to_mph":  unary(func(kph float64) float64 { return kph / 1.609344 }),
+	"ms_to_kph":   unary(func(ms float64) float64 { return ms * 3.6 }),
+	"inhg_to_hpa": unary(func(inhg float64) float64 { return inhg * 33.8639 }),
+	"hpa_to_inhg": unary(func(hpa float64) float64 { return hpa / 33.8639 }),
+	// from_decimals converts an integer amount in the smallest unit of a token into whole tokens, e.g. wei to ether
+	"from_decimals": {2, 2, func(args []float64) (float64, error) { return args[0] / math.Pow(10, args[1]), nil }},
+}
+
+func unary(f func(float64) float64) Function {
+	return Function{1, 1, func(args []float64) (float64, error) { return f(args[0]), nil }}
+}
+
+func minOf(args []float64) (float64, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = math.Min(result, arg)
+	}
+	return result, nil
+}
+
+func maxOf(args []float64) (float64, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = math.Max(result, arg)
+	}
+	return result, nil
+}
+
+// roundTo rounds its first argument to the number of decimal places given by the optional second argument
+func roundTo(args []float64) (float64, error) {
+	if len(args) == 1 {
+		return math.Round(args[0]), nil
+	}
+	if args[1] < 0 || args[1] != math.Trunc(args[1]) {
+		return 0, fmt.Errorf("decimal places must be a non-negative integer, got %v", args[1])
+	}
+	scale := math.Pow(10, args[1])
+	return math.Round(args[0]*scale) / scale, nil
+}
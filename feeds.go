@@ -0,0 +1,261 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+)
+
+// ErrUnknownKey is returned when managing a key that the oracle doesn't have
+var ErrUnknownKey = errors.New("Unknown key")
+
+// KeyInfo describes the configuration of a key
+type KeyInfo struct {
+	Key                 string            `json:"key"`
+	Paused              bool              `json:"paused"`
+	Summarizer          string            `json:"summarizer,omitempty"`
+	FieldSummarizers    map[string]string `json:"field_summarizers,omitempty"`
+	PublishSummaryStats bool              `json:"publish_summary_stats,omitempty"`
+	SmoothedFields      []string          `json:"smoothed_fields,omitempty"` // names the smoothed values are published as
+	Endpoints           []EndpointInfo    `json:"endpoints,omitempty"`
+	Derived             *DerivedInfo      `json:"derived,omitempty"`
+	Schedule            *ScheduleInfo     `json:"schedule,omitempty"`
+}
+
+// EndpointInfo describes an endpoint of a key
+type EndpointInfo struct {
+	URL         string            `json:"url"`
+	JSONPaths   map[string]string `json:"json_paths"`
+	Expressions map[string]string `json:"expressions,omitempty"`
+}
+
+// DerivedInfo describes how a derived key is computed
+type DerivedInfo struct {
+	Expressions map[string]string `json:"expressions,omitempty"`
+	DependsOn   []string          `json:"depends_on"`
+}
+
+// ScheduleInfo describes the schedule of a key that isn't updated at the configured update interval
+type ScheduleInfo struct {
+	Interval string `json:"interval,omitempty"`
+	Cron     string `json:"cron,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+	Jitter   string `json:"jitter,omitempty"`
+}
+
+// Keys returns the configuration of every key, in the order they are updated
+func (o *Oracle) Keys() []KeyInfo {
+	o.engineMu.RLock()
+	defer o.engineMu.RUnlock()
+	keys := make([]KeyInfo, 0, len(o.plan.metadata))
+	for _, meta := range o.plan.metadata {
+		keys = append(keys, keyInfo(meta, o.plan.derivations[meta.Key], o.paused[meta.Key]))
+	}
+	return keys
+}
+
+// SetKey adds a key to the oracle, or replaces the key with the same name. The change applies from the next round.
+func (o *Oracle) SetKey(meta models.MappingMetadata) error {
+	o.engineMu.Lock()
+	defer o.engineMu.Unlock()
+	metadata := make([]models.MappingMetadata, 0, len(o.engine.Metadata)+1)
+	replaced := false
+	for _, existing := range o.engine.Metadata {
+		if existing.Key == meta.Key {
+			existing, replaced = meta, true
+		}
+		metadata = append(metadata, existing)
+	}
+	if !replaced {
+		metadata = append(metadata, meta)
+	}
+	if err := o.setMetadata(metadata); err != nil {
+		return err
+	}
+	if replaced {
+		o.log.Infof("Updated key %s", meta.Key)
+	} else {
+		o.log.Infof("Added key %s", meta.Key)
+	}
+	return nil
+}
+
+// RemoveKey removes a key from the oracle. Keys derived from it must be removed first. The change applies from the
+// next round; values already written to the canister are left as they are.
+func (o *Oracle) RemoveKey(key string) error {
+	o.engineMu.Lock()
+	defer o.engineMu.Unlock()
+	metadata := make([]models.MappingMetadata, 0, len(o.engine.Metadata))
+	for _, existing := range o.engine.Metadata {
+		if existing.Key != key {
+			metadata = append(metadata, existing)
+		}
+	}
+	if len(metadata) == len(o.engine.Metadata) {
+		return fmt.Errorf("%w %q", ErrUnknownKey, key)
+	}
+	if err := o.setMetadata(metadata); err != nil {
+		return err
+	}
+	o.forgetKey(key)
+	o.log.Infof("Removed key %s", key)
+	return nil
+}
+
+// forgetKey drops what the oracle keeps about a key that was removed: whether it is paused, the history of its fields
+// and its metrics. engineMu must be held for writing.
+func (o *Oracle) forgetKey(key string) {
+	delete(o.paused, key)
+	o.history.remove(key)
+	o.metrics.forgetKey(key)
+}
+
+// setMetadata validates the given keys and makes them the oracle's keys; engineMu must be held for writing
+func (o *Oracle) setMetadata(metadata []models.MappingMetadata) error {
+	engine := &models.Engine{Metadata: metadata}
+	plan, err := newRoundPlan(engine)
+	if err != nil {
+		return err
+	}
+	o.engine, o.plan = engine, plan
+	o.reschedule()
+	return nil
+}
+
+// PauseKey stops updating a key until ResumeKey is called. Keys derived from it are not updated while it is paused.
+func (o *Oracle) PauseKey(key string) error {
+	return o.setPaused(key, true)
+}
+
+// ResumeKey resumes updating a paused key
+func (o *Oracle) ResumeKey(key string) error {
+	return o.setPaused(key, false)
+}
+
+func (o *Oracle) setPaused(key string, paused bool) error {
+	o.engineMu.Lock()
+	defer o.engineMu.Unlock()
+	if _, ok := o.plan.find(key); !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, key)
+	}
+	if paused {
+		o.paused[key] = true
+		o.log.Infof("Paused key %s", key)
+	} else {
+		delete(o.paused, key)
+		o.log.Infof("Resumed key %s", key)
+	}
+	return nil
+}
+
+// UpdateKey immediately retrieves and publishes the value of a single key, even if it is paused, waiting for a round in
+// progress to finish first. Derived keys are computed from the latest values of their dependencies.
+func (o *Oracle) UpdateKey(ctx context.Context, key string) error {
+	o.roundMu.Lock()
+	defer o.roundMu.Unlock()
+	plan, _ := o.snapshot()
+	meta, ok := plan.find(key)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKey, key)
+	}
+	defer o.saveQuotas()
+	return o.updateKey(ctx, plan, meta, utils.NewRequestGroup())
+}
+
+// snapshot returns the current round plan and paused keys, which stay unchanged for the caller even if keys are
+// changed in the meantime
+func (o *Oracle) snapshot() (*roundPlan, map[string]bool) {
+	o.engineMu.RLock()
+	defer o.engineMu.RUnlock()
+	paused := make(map[string]bool, len(o.paused))
+	for key := range o.paused {
+		paused[key] = true
+	}
+	return o.plan, paused
+}
+
+// updateKey updates a single key, recording its values for keys derived from it, and sharing responses with other keys
+// through the given request group; roundMu must be held
+func (o *Oracle) updateKey(ctx context.Context, plan *roundPlan, meta models.MappingMetadata, requests *utils.RequestGroup) error {
+	var values map[string]float64
+	var err error
+	if d, ok := plan.derivations[meta.Key]; ok {
+		o.latestMu.Lock()
+		latest := make(map[string]map[string]float64, len(d.dependsOn))
+		for _, dep := range d.dependsOn {
+			if values, ok := o.latest[dep]; ok {
+				latest[dep] = values
+			}
+		}
+		o.latestMu.Unlock()
+		values, err = o.updateDerivedMeta(ctx, meta, d, latest)
+	} else {
+		values, err = o.updateMeta(ctx, meta, requests)
+	}
+	o.latestMu.Lock()
+	defer o.latestMu.Unlock()
+	if err != nil {
+		delete(o.latest, meta.Key)
+		o.status.keyUpdated(meta.Key, time.Now(), nil, err)
+		return err
+	}
+	o.latest[meta.Key] = values
+	return nil
+}
+
+func (p *roundPlan) find(key string) (models.MappingMetadata, bool) {
+	for _, meta := range p.metadata {
+		if meta.Key == key {
+			return meta, true
+		}
+	}
+	return models.MappingMetadata{}, false
+}
+
+func keyInfo(meta models.MappingMetadata, d *derivation, paused bool) KeyInfo {
+	info := KeyInfo{Key: meta.Key, Paused: paused, PublishSummaryStats: meta.PublishSummaryStats}
+	if meta.DetailedSummaryFunc != nil {
+		info.Summarizer = summaryFuncName(meta.DetailedSummaryFunc)
+	} else if meta.SummaryFunc != nil {
+		info.Summarizer = summaryFuncName(meta.SummaryFunc)
+	}
+	for field, f := range meta.FieldSummaryFuncs {
+		if info.FieldSummarizers == nil {
+			info.FieldSummarizers = make(map[string]string)
+		}
+		info.FieldSummarizers[field] = summaryFuncName(f)
+	}
+	for field, f := range meta.FieldDetailedSummaryFuncs {
+		if info.FieldSummarizers == nil {
+			info.FieldSummarizers = make(map[string]string)
+		}
+		info.FieldSummarizers[field] = summaryFuncName(f)
+	}
+	for _, smoothed := range meta.SmoothedFields {
+		name := smoothed.Name
+		if name == "" {
+			name = smoothed.Field
+		}
+		info.SmoothedFields = append(info.SmoothedFields, name)
+	}
+	for _, endpoint := range meta.Endpoints {
+		info.Endpoints = append(info.Endpoints, EndpointInfo{URL: endpoint.Endpoint, JSONPaths: endpoint.JSONPaths, Expressions: endpoint.Expressions})
+	}
+	if d != nil {
+		info.Derived = &DerivedInfo{Expressions: meta.Derived.Expressions, DependsOn: d.dependsOn}
+	}
+	if s := meta.Schedule; s != nil {
+		info.Schedule = &ScheduleInfo{Cron: s.Cron, Timezone: s.Timezone}
+		if s.Interval != 0 {
+			info.Schedule.Interval = s.Interval.String()
+		}
+		if s.Jitter != 0 {
+			info.Schedule.Jitter = s.Jitter.String()
+		}
+	}
+	return info
+}
@@ -1,157 +1,545 @@
 package framework
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/hyplabs/dfinity-oracle-framework/config"
 	"github.com/hyplabs/dfinity-oracle-framework/models"
 	"github.com/hyplabs/dfinity-oracle-framework/summary"
 	"github.com/hyplabs/dfinity-oracle-framework/utils"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultShutdownGracePeriod is how long an update round may take to finish after shutdown when
+// models.Config.ShutdownGracePeriod is not set
+const defaultShutdownGracePeriod = 30 * time.Second
+
 // Oracle is an instance of an oracle
 type Oracle struct {
 	config     *models.Config
 	dfxService *DFXService
 	engine     *models.Engine
+	plan       *roundPlan
+	history    *history
+	metrics    *oracleMetrics
+	status     *statusTracker
 	log        *logrus.Logger
+
+	// engineMu guards engine, plan, paused, registry, clients and the reloadable settings of config, which can change while the oracle runs; rounds use a snapshot taken
+	// when they start, so changes apply between rounds
+	engineMu sync.RWMutex
+	paused   map[string]bool
+	registry *config.Registry
+	clients  *utils.Clients
+	// rescheduled is signalled when the keys or the configuration change, so that Run reschedules the next round
+	rescheduled chan struct{}
+
+	// roundMu serializes update rounds and immediate key updates, so that canister writes for a key stay ordered
+	roundMu sync.Mutex
+	// latestMu guards latest, the values of every key from its last successful update, which keys of the same round
+	// update concurrently
+	latestMu   sync.Mutex
+	latest     map[string]map[string]float64
+	limiter    *requestLimiter
+	rateLimits *rateLimits
+	responses  *utils.ResponseCache
+
+	bootstrap bootstrapState
+	readiness readinessCache
+
+	runMu   sync.Mutex
+	stopRun context.CancelFunc
+	runDone chan struct{}
 }
 
-// NewOracle creates a new oracle instance
-func NewOracle(config *models.Config, engine *models.Engine) *Oracle {
+// NewOracle creates a new oracle instance, returning an error if the configuration is invalid (e.g. it has no update
+// interval), the engine is invalid (e.g. derived keys form a cycle) or the canister template cannot be rendered
+func NewOracle(config *models.Config, engine *models.Engine) (*Oracle, error) {
 	log := logrus.New()
 	log.Formatter = &logrus.JSONFormatter{}
 
-	dfxService := NewDFXService(config, log)
-
-	return &Oracle{
-		config:     config,
-		dfxService: dfxService,
-		engine:     engine,
-		log:        log,
+	if config.UpdateInterval <= 0 {
+		return nil, fmt.Errorf("Invalid update interval %v", config.UpdateInterval)
+	}
+	plan, err := newRoundPlan(engine)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := renderCanister(config); err != nil {
+		return nil, err
 	}
-}
 
-// Bootstrap bootstraps the canister installation
-func (o *Oracle) Bootstrap() error {
-	if err := o.dfxService.createNewDfxProject(); err != nil {
-		panic(err)
+	rateLimits, err := newRateLimits(config)
+	if err != nil {
+		return nil, err
 	}
-	if err := o.dfxService.updateCanisterCode(); err != nil {
-		panic(err)
+	clients, err := newClients(config, engine)
+	if err != nil {
+		return nil, err
 	}
-	if err := o.dfxService.stopDfxNetwork(); err != nil {
-		panic(err)
+
+	metrics := newOracleMetrics()
+	dfxService := NewDFXService(config, log)
+	dfxService.metrics = metrics
+
+	o := &Oracle{
+		config:      config,
+		dfxService:  dfxService,
+		engine:      engine,
+		plan:        plan,
+		history:     newHistory(config.HistorySize),
+		metrics:     metrics,
+		status:      newStatusTracker(),
+		log:         log,
+		paused:      make(map[string]bool),
+		rescheduled: make(chan struct{}, 1),
+		latest:      make(map[string]map[string]float64),
+		limiter:     newRequestLimiter(config.MaxConcurrentRequests, config.MaxRequestsPerHost),
+		rateLimits:  rateLimits,
+		responses:   utils.NewResponseCache(),
+		clients:     clients,
 	}
-	if err := o.dfxService.startDfxNetwork(); err != nil {
-		panic(err)
+	o.bootstrap.path = filepath.Join(dfxService.projectDir(), bootstrapStateFile)
+	o.bootstrap.target = dfxService.target()
+	if err := o.bootstrap.load(); err != nil {
+		log.WithError(err).Warnln("Could not load bootstrap progress, bootstrapping from the start")
 	}
-	if err := o.dfxService.createWriterIdentityIfNeeded(); err != nil {
-		panic(err)
+	return o, nil
+}
+
+// Run starts the Oracle service, updating each key of the canister on its schedule, or at the configured interval if it
+// has none, in rounds of the keys that are due at the same time. It runs until the given context is cancelled or Stop
+// is called. A round that is in progress at that point is given the configured grace period to finish; Run
+// returns nil if it does, or an error if the round had to be aborted.
+func (o *Oracle) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+
+	o.runMu.Lock()
+	if o.stopRun != nil {
+		o.runMu.Unlock()
+		return fmt.Errorf("Oracle is already running")
 	}
+	o.stopRun, o.runDone = cancel, done
+	o.runMu.Unlock()
+	defer func() {
+		o.runMu.Lock()
+		o.stopRun, o.runDone = nil, nil
+		o.runMu.Unlock()
+	}()
 
-	canisterExists, err := o.dfxService.doesCanisterExist()
-	if err != nil {
-		panic(err)
+	if o.config.HTTPAddress != "" {
+		stopServer, err := o.startHTTPServer("HTTP endpoints", o.config.HTTPAddress, o.Handler())
+		if err != nil {
+			return err
+		}
+		defer stopServer()
 	}
-	if !canisterExists {
-		if err := o.dfxService.createCanister(); err != nil {
+	if o.config.AdminAddress != "" {
+		handler, err := o.AdminHandler()
+		if err != nil {
 			return err
 		}
+		stopServer, err := o.startHTTPServer("admin API", o.config.AdminAddress, handler)
+		if err != nil {
+			return err
+		}
+		defer stopServer()
 	}
-	if err := o.dfxService.buildCanister(); err != nil {
-		panic(err)
+
+	o.log.Infof("Starting %s oracle service...", o.config.CanisterName)
+	o.status.setRunning(true)
+	defer o.status.setRunning(false)
+	scheduler := newScheduler()
+	for {
+		if ctx.Err() != nil {
+			o.log.Infof("Stopped %s oracle service", o.config.CanisterName)
+			return nil
+		}
+		plan, _ := o.snapshot()
+		scheduler.sync(plan, o.settings().UpdateInterval, time.Now())
+		next := scheduler.nextDue()
+		o.status.setNextUpdate(next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+			if err := o.runRound(ctx, scheduler.take(time.Now())); err != nil {
+				return err
+			}
+		case <-o.rescheduled:
+			// keys or the update interval changed, so the next update may be due at a different time
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+		}
 	}
-	if err := o.dfxService.installCanister(canisterExists); err != nil {
-		panic(err)
+}
+
+// Stop stops a running Oracle service, waiting for Run to return
+func (o *Oracle) Stop() {
+	o.runMu.Lock()
+	stop, done := o.stopRun, o.runDone
+	o.runMu.Unlock()
+	if stop == nil {
+		return
 	}
-	canisterRunning, err := o.dfxService.isCanisterRunning()
-	if err != nil {
-		panic(err)
+	stop()
+	<-done
+}
+
+// runRound performs an update round of the given keys; if the given context is cancelled in the meantime, the round is
+// allowed to finish within the shutdown grace period before being aborted
+func (o *Oracle) runRound(ctx context.Context, due *dueKeys) error {
+	roundCtx, abortRound := context.WithCancel(context.Background())
+	defer abortRound()
+	roundDone := make(chan struct{})
+	go func() {
+		o.updateKeys(roundCtx, due)
+		close(roundDone)
+	}()
+
+	select {
+	case <-roundDone:
+		return nil
+	case <-ctx.Done():
 	}
-	if !canisterRunning {
-		if err := o.dfxService.startCanister(); err != nil {
-			panic(err)
-		}
+
+	gracePeriod := o.settings().ShutdownGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = defaultShutdownGracePeriod
 	}
+	o.log.Infof("Shutting down, waiting up to %v for the update round in progress to finish...", gracePeriod)
+	timer := time.NewTimer(gracePeriod)
+	defer timer.Stop()
+	select {
+	case <-roundDone:
+		o.log.Infof("Stopped %s oracle service", o.config.CanisterName)
+		return nil
+	case <-timer.C:
+	}
+	abortRound()
+	<-roundDone
+	return fmt.Errorf("Update round did not finish within the shutdown grace period of %v and was aborted", gracePeriod)
+}
 
-	isOwner, err := o.dfxService.checkIsOwner()
-	if err != nil {
-		panic(err)
+func (o *Oracle) updateOracle(ctx context.Context) error {
+	return o.updateKeys(ctx, nil)
+}
+
+// updateKeys performs an update round of the given keys, or of every key if due is nil, returning an error listing the
+// keys that were not updated
+func (o *Oracle) updateKeys(ctx context.Context, due *dueKeys) error {
+	o.roundMu.Lock()
+	defer o.roundMu.Unlock()
+	start := time.Now()
+	o.status.roundStarted(start)
+	defer func() {
+		o.metrics.observeRound(time.Since(start))
+		o.status.roundFinished(time.Now())
+	}()
+
+	plan, paused := o.snapshot()
+	o.latestMu.Lock()
+	for key := range paused {
+		// keys derived from paused keys aren't updated in rounds, even if the paused key was updated with UpdateKey
+		delete(o.latest, key)
 	}
-	if !isOwner {
-		if err := o.dfxService.assignOwnerRole(); err != nil {
-			panic(err)
+	o.latestMu.Unlock()
+	keys := make([]models.MappingMetadata, 0, len(plan.metadata))
+	for _, meta := range plan.metadata {
+		if due != nil && !due.includes(plan, meta.Key) {
+			continue
 		}
+		if paused[meta.Key] {
+			o.log.Infof("Skipping paused key %s", meta.Key)
+			continue
+		}
+		keys = append(keys, meta)
 	}
-	writerPrincipal, err := o.dfxService.getWriterIDPrincipal()
-	if err != nil {
-		panic(err)
+	failed := o.updateKeysConcurrently(ctx, plan, keys)
+	o.saveQuotas()
+	if ctx.Err() == nil {
+		o.log.Infof("Oracle update completed")
 	}
-	if err := o.dfxService.assignWriterRole(writerPrincipal); err != nil {
-		panic(err)
+	if len(failed) > 0 {
+		return fmt.Errorf("Could not update %d of %d keys: %s", len(failed), len(keys), strings.Join(failed, ", "))
 	}
 	return nil
 }
 
-// Run starts the Oracle service
-func (o *Oracle) Run() {
-	o.log.Infof("Starting %s oracle service...", o.config.CanisterName)
-
-	o.updateOracle()
-	for range time.Tick(o.config.UpdateInterval) {
-		o.updateOracle()
+func (o *Oracle) updateDerivedMeta(ctx context.Context, meta models.MappingMetadata, d *derivation, latest map[string]map[string]float64) (map[string]float64, error) {
+	values, err := d.derive(meta, latest)
+	if err != nil {
+		o.log.WithError(err).Errorf("Could not derive value, skipping update for %s", meta.Key)
+		return nil, err
 	}
-}
+	valStr, _ := json.Marshal(values)
+	o.log.Infof("Derived value %v for %s from %v", string(valStr), meta.Key, d.dependsOn)
 
-func (o *Oracle) updateOracle() {
-	for _, meta := range o.engine.Metadata {
-		o.updateMeta(meta)
+	o.smooth(meta, values, time.Now())
+	if err := o.publish(ctx, meta.Key, values); err != nil {
+		return nil, err
 	}
-	o.log.Infof("Oracle update completed")
+	return values, nil
 }
 
-func (o *Oracle) updateMeta(meta models.MappingMetadata) error {
+func (o *Oracle) updateMeta(ctx context.Context, meta models.MappingMetadata, requests *utils.RequestGroup) (map[string]float64, error) {
 	type apiInfo struct {
 		Endpoint models.Endpoint
 		Value    map[string]float64
 		Err      error
 	}
 	dataset := make([]map[string]float64, 0)
-	ch := make(chan apiInfo)
+	ch := make(chan apiInfo, len(meta.Endpoints))
 	for _, endpoint := range meta.Endpoints {
 		go func(endpoint models.Endpoint, ch chan<- apiInfo) {
-			val, err := utils.GetAPIInfo(endpoint)
+			start := time.Now()
+			body, shared, err := requests.Do(endpoint, func() ([]byte, error) {
+				// fresh cached responses don't count against rate limits
+				if body, ok := o.responses.Fresh(endpoint); ok {
+					o.metrics.observeCached(meta.Key, endpoint.Endpoint, "fresh")
+					return body, nil
+				}
+				if err := o.waitForRateLimits(ctx, endpoint); err != nil {
+					return nil, err
+				}
+				release, err := o.limiter.acquire(ctx, endpoint.Endpoint)
+				if err != nil {
+					return nil, err
+				}
+				defer release()
+				client, err := o.httpClients().Client(endpoint.Transport)
+				if err != nil {
+					return nil, &utils.APIError{Class: utils.ErrorClassRequest, Err: err}
+				}
+				body, notModified, err := o.responses.FetchEndpoint(ctx, client, endpoint)
+				if notModified {
+					o.metrics.observeCached(meta.Key, endpoint.Endpoint, "not_modified")
+				}
+				return body, err
+			})
+			var val map[string]float64
+			if err == nil {
+				val, err = utils.ParseAPIInfo(body, endpoint)
+			}
+			if shared {
+				o.metrics.observeCoalesced(meta.Key, endpoint.Endpoint)
+			}
+			result := "success"
+			if err != nil {
+				result = utils.ErrorClass(err)
+			}
+			o.metrics.observeFetch(meta.Key, endpoint.Endpoint, time.Since(start), result)
 			ch <- apiInfo{Endpoint: endpoint, Value: val, Err: err}
 		}(endpoint, ch)
 	}
 	for range meta.Endpoints {
 		r := <-ch
+		if errors.Is(r.Err, errQuotaExhausted) {
+			o.log.Warnf("Skipping API %s for %s to stay within its quota", endpointLabel(r.Endpoint.Endpoint), meta.Key)
+			continue
+		}
 		if r.Err != nil {
 			o.log.WithError(r.Err).Errorf("Could not retrieve information from API %s", r.Endpoint.Endpoint)
-			return r.Err
+			return nil, r.Err
 		}
 		dataset = append(dataset, r.Value)
 		valStr, err := json.Marshal(r.Value)
 		if err != nil {
 			o.log.WithError(err).Errorf("Retrieved non-JSON-serializable value %v from %s for %s", r.Value, r.Endpoint.Endpoint, meta.Key)
-			return err
+			return nil, err
 		}
 		o.log.Infof("Retrieved value %v from %s for %s", string(valStr), r.Endpoint.Endpoint, meta.Key)
 	}
 	if len(dataset) == 0 {
 		o.log.Errorf("No values from any API endpoints, skipping update for %s", meta.Key)
-		return fmt.Errorf("No values from any API endpoints, skipping update for %s", meta.Key)
+		return nil, fmt.Errorf("No values from any API endpoints, skipping update for %s", meta.Key)
 	}
 
-	var summarizedVal map[string]float64
-	if meta.SummaryFunc != nil {
-		summarizedVal = meta.SummaryFunc(dataset)
-	} else {
-		summarizedVal = summary.MeanWithoutOutliers(dataset)
+	summarizedResults := o.summarize(meta, dataset)
+	for field, result := range summarizedResults {
+		o.log.Infof("Summarized %s.%s to %v from %d sources (%d rejected), stddev %v, range [%v, %v], 95%% CI [%v, %v]",
+			meta.Key, field, result.Value, result.Sources, result.Rejected, result.StdDev, result.Min, result.Max, result.ConfidenceLow, result.ConfidenceHigh)
+		o.metrics.observeRejected(meta.Key, field, result.Rejected)
+	}
+	values, err := summaryValues(meta, summarizedResults)
+	if err != nil {
+		o.log.WithError(err).Errorf("Could not publish summary statistics for %s", meta.Key)
+		return nil, err
 	}
-	o.dfxService.updateValueInCanister(meta.Key, summarizedVal)
+	o.smooth(meta, values, time.Now())
+	if err := o.publish(ctx, meta.Key, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// publish writes the values of a key to the canister, returning an error if they could not be written
+func (o *Oracle) publish(ctx context.Context, key string, values map[string]float64) error {
+	if err := o.dfxService.updateValueInCanister(ctx, key, values); err != nil {
+		return fmt.Errorf("Could not write to canister: %w", err)
+	}
+	now := time.Now()
+	o.metrics.observePublished(key, values, now)
+	o.status.keyUpdated(key, now, values, nil)
 	return nil
 }
+
+// summarize applies the per-field summarizers of the given metadata, falling back to its SummaryFunc (or the default
+// summarizer) for every field without one
+func (o *Oracle) summarize(meta models.MappingMetadata, dataset []map[string]float64) map[string]models.SummaryResult {
+	defaultFunc, defaultName := meta.DetailedSummaryFunc, summaryFuncName(meta.DetailedSummaryFunc)
+	if defaultFunc == nil && meta.SummaryFunc != nil {
+		defaultFunc, defaultName = summary.Detailed(meta.SummaryFunc), summaryFuncName(meta.SummaryFunc)
+	}
+	if defaultFunc == nil {
+		defaultFunc, defaultName = summary.MeanWithoutOutliersDetailed, summaryFuncName(summary.MeanWithoutOutliersDetailed)
+	}
+
+	result := make(map[string]models.SummaryResult)
+	remaining := make([]map[string]float64, 0, len(dataset))
+	fieldDatasets := make(map[string][]map[string]float64)
+	for _, entry := range dataset {
+		remainingEntry := make(map[string]float64)
+		for field, value := range entry {
+			if hasFieldSummaryFunc(meta, field) {
+				fieldDatasets[field] = append(fieldDatasets[field], map[string]float64{field: value})
+			} else {
+				remainingEntry[field] = value
+			}
+		}
+		remaining = append(remaining, remainingEntry)
+	}
+
+	for field, fieldDataset := range fieldDatasets {
+		summaryFunc, name := defaultFunc, defaultName
+		if f := meta.FieldDetailedSummaryFuncs[field]; f != nil {
+			summaryFunc, name = f, summaryFuncName(f)
+		} else if f := meta.FieldSummaryFuncs[field]; f != nil {
+			summaryFunc, name = summary.Detailed(f), summaryFuncName(f)
+		}
+		value, ok := summaryFunc(fieldDataset)[field]
+		if !ok {
+			o.log.Errorf("Summarizer %s produced no value for field %s of %s", name, field, meta.Key)
+			continue
+		}
+		result[field] = value
+		o.log.Infof("Summarized field %s of %s using %s", field, meta.Key, name)
+	}
+
+	if len(fieldDatasets) == 0 || hasFields(remaining) {
+		for field, value := range defaultFunc(remaining) {
+			result[field] = value
+			o.log.Infof("Summarized field %s of %s using %s", field, meta.Key, defaultName)
+		}
+	}
+	return result
+}
+
+func hasFieldSummaryFunc(meta models.MappingMetadata, field string) bool {
+	_, hasDetailed := meta.FieldDetailedSummaryFuncs[field]
+	_, hasPlain := meta.FieldSummaryFuncs[field]
+	return hasDetailed || hasPlain
+}
+
+// summaryStatsSuffixes are appended to the name of a field to name its dispersion metadata
+var summaryStatsSuffixes = []string{"_sources", "_rejected", "_stddev", "_min", "_max", "_ci_low", "_ci_high"}
+
+// summaryValues returns the values to publish for the given summary results, including their dispersion metadata if
+// requested, returning an error if the name of any of that metadata is also the name of a field
+func summaryValues(meta models.MappingMetadata, results map[string]models.SummaryResult) (map[string]float64, error) {
+	values := summary.Values(results)
+	if !meta.PublishSummaryStats {
+		return values, nil
+	}
+	for field := range results {
+		for _, suffix := range summaryStatsSuffixes {
+			if _, ok := results[field+suffix]; ok {
+				return nil, fmt.Errorf("Field %s of %s has the same name as a summary statistic of field %s", field+suffix, meta.Key, field)
+			}
+		}
+	}
+	for field, result := range results {
+		values[field+"_sources"] = float64(result.Sources)
+		values[field+"_rejected"] = float64(result.Rejected)
+		values[field+"_stddev"] = result.StdDev
+		values[field+"_min"] = result.Min
+		values[field+"_max"] = result.Max
+		values[field+"_ci_low"] = result.ConfidenceLow
+		values[field+"_ci_high"] = result.ConfidenceHigh
+	}
+	return values, nil
+}
+
+// smooth records the spot values of this round in the history, then adds the smoothed fields of the given metadata
+func (o *Oracle) smooth(meta models.MappingMetadata, values map[string]float64, now time.Time) {
+	windows := make(map[string]time.Duration)
+	for _, smoothed := range meta.SmoothedFields {
+		if window, ok := windows[smoothed.Field]; !ok || smoothed.Window > window {
+			windows[smoothed.Field] = smoothed.Window
+		}
+	}
+	for field, window := range windows {
+		if _, ok := values[field]; ok {
+			o.history.record(meta.Key, field, models.Sample{Time: now, Value: values[field]}, window)
+		}
+	}
+
+	smoothedValues := make(map[string]float64)
+	for _, smoothed := range meta.SmoothedFields {
+		samples := o.history.get(meta.Key, smoothed.Field)
+		if len(samples) == 0 {
+			o.log.Errorf("No history for field %s of %s, skipping smoothed value", smoothed.Field, meta.Key)
+			continue
+		}
+		name := smoothed.Name
+		if name == "" {
+			name = smoothed.Field
+		}
+		value := smoothed.SmoothingFunc(samples, now)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			o.log.Errorf("Smoothing field %s of %s gave %v, skipping smoothed value", smoothed.Field, meta.Key, value)
+			continue
+		}
+		smoothedValues[name] = value
+		o.log.Infof("Smoothed field %s of %s over %d samples to %v, publishing as %s", smoothed.Field, meta.Key, len(samples), smoothedValues[name], name)
+	}
+	for name, value := range smoothedValues {
+		values[name] = value
+	}
+}
+
+// summaryFuncName returns a short human-readable name for a summarizer, such as "summary.Median"
+func summaryFuncName(summaryFunc interface{}) string {
+	value := reflect.ValueOf(summaryFunc)
+	if !value.IsValid() || value.IsNil() {
+		return "none"
+	}
+	fn := runtime.FuncForPC(value.Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+func hasFields(dataset []map[string]float64) bool {
+	for _, entry := range dataset {
+		if len(entry) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+package framework
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func newTestOracle(t *testing.T, config *models.Config, engine *models.Engine) *Oracle {
+	if config.UpdateInterval == 0 {
+		config.UpdateInterval = time.Minute
+	}
+	o, err := NewOracle(config, engine)
+	if err != nil {
+		t.Fatalf("Could not create oracle: %v", err)
+	}
+	o.log.Out = ioutil.Discard
+	return o
+}
+
+func TestStopEndsRun(t *testing.T) {
+	o := newTestOracle(t, &models.Config{CanisterName: "test", UpdateInterval: 10 * time.Millisecond}, &models.Engine{})
+
+	result := make(chan error)
+	go func() { result <- o.Run(context.Background()) }()
+	time.Sleep(30 * time.Millisecond)
+	o.Stop()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after Stop")
+	}
+}
+
+func TestRunAbortsRoundAfterGracePeriod(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "slow", Endpoints: []models.Endpoint{{Endpoint: server.URL, JSONPaths: map[string]string{"v": "$.v"}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: "test", UpdateInterval: time.Hour, ShutdownGracePeriod: 20 * time.Millisecond}, engine)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- o.Run(ctx) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Errorf("Expected an error for the aborted round")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after the grace period")
+	}
+}
+
+func TestRoundRecordsMetrics(t *testing.T) {
+	_, restore := fakeDfx(t, `case "$*" in *update_map_value*) ;; *) exit 1 ;; esac`)
+	defer restore()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"v": 1.5}`))
+	}))
+	defer good.Close()
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "good", Endpoints: []models.Endpoint{{Endpoint: good.URL + "/v?key=secret", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "bad", Endpoints: []models.Endpoint{{Endpoint: bad.URL, JSONPaths: map[string]string{"v": "$.v"}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, engine)
+	o.RunOnce(context.Background())
+
+	recorder := httptest.NewRecorder()
+	o.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"oracle_round_duration_seconds_count 1\n",
+		`oracle_endpoint_fetches_total{key="good",endpoint="` + good.URL + `/v",result="success"} 1`,
+		`oracle_endpoint_fetches_total{key="bad",endpoint="` + bad.URL + `",result="http_status"} 1`,
+		`oracle_rejected_values_total{key="good",field="v"} 0`,
+		`oracle_published_value{key="good",field="v"} 1.5`,
+		`oracle_published_timestamp_seconds{key="good",field="v"}`,
+		`oracle_dfx_call_duration_seconds_count{command="canister call update_map_value"} 1`,
+		`oracle_staleness_seconds{key="good"}`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", expected, body)
+		}
+	}
+	if strings.Contains(body, "secret") {
+		t.Errorf("Expected endpoint query strings to be left out of metrics")
+	}
+}
+
+func TestNewOracleRejectsInvalidUpdateInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := NewOracle(&models.Config{CanisterName: "test", UpdateInterval: interval}, &models.Engine{}); err == nil {
+			t.Errorf("Expected an error for update interval %v", interval)
+		}
+	}
+}
+
+// tempDir creates a temporary directory that is removed when the test ends
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oracle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestSummaryValuesRejectCollidingFields(t *testing.T) {
+	results := map[string]models.SummaryResult{"price": {Value: 10, Sources: 2}, "price_sources": {Value: 3}}
+
+	if _, err := summaryValues(models.MappingMetadata{Key: "A", PublishSummaryStats: true}, results); err == nil {
+		t.Errorf("Expected an error for a field named like a summary statistic")
+	}
+	if values, err := summaryValues(models.MappingMetadata{Key: "A"}, results); err != nil || values["price_sources"] != 3 {
+		t.Errorf("Expected the field to be published without summary statistics, got %v, %v", values, err)
+	}
+}
+
+func TestFailedCanisterWriteFailsKey(t *testing.T) {
+	_, restore := fakeDfx(t, `case "$*" in *update_map_value*) exit 1 ;; esac`)
+	defer restore()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"v": 1.5}`))
+	}))
+	defer server.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "a", Endpoints: []models.Endpoint{{Endpoint: server.URL, JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "b", Derived: &models.Derivation{Expressions: map[string]string{"v": "a.v * 2"}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, engine)
+
+	if err := o.UpdateKey(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "Could not write to canister") {
+		t.Errorf("Expected the canister write error, got %v", err)
+	}
+	if _, ok := o.latest["a"]; ok {
+		t.Errorf("Expected values that were not written not to be kept for derived keys")
+	}
+	status := o.ServiceStatus().Keys
+	if len(status) != 1 || status[0].Success || status[0].PublishedAt != nil {
+		t.Errorf("Expected the key to have failed, got %+v", status)
+	}
+	if err := o.UpdateKey(context.Background(), "b"); err == nil {
+		t.Errorf("Expected the derived key to fail without a published dependency")
+	}
+	if err := o.RunOnce(context.Background()); err == nil || !strings.Contains(err.Error(), "2 of 2 keys: a, b") {
+		t.Errorf("Expected the round to report the keys that failed, got %v", err)
+	}
+}
@@ -3,7 +3,9 @@ module github.com/hyplabs/dfinity-oracle-framework
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/oliveagle/jsonpath v0.0.0-20180606110733-2e52cf6e6852
 	github.com/sirupsen/logrus v1.8.1
 	golang.org/x/sys v0.0.0-20210403161142-5e06dd20ab57 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,64 @@
+package framework
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// defaultHistorySize is the number of samples kept per field when models.Config.HistorySize is not set
+const defaultHistorySize = 1024
+
+// history stores the most recent summarized values of every field, oldest first
+type history struct {
+	mu      sync.Mutex
+	size    int
+	samples map[string]map[string][]models.Sample
+}
+
+func newHistory(size int) *history {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	return &history{
+		size:    size,
+		samples: make(map[string]map[string][]models.Sample),
+	}
+}
+
+// record appends a sample to the history of the given field, evicting the oldest sample if the history is full and
+// that sample is no longer needed for the given window
+func (h *history) record(key string, field string, sample models.Sample, window time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.samples[key] == nil {
+		h.samples[key] = make(map[string][]models.Sample)
+	}
+	samples := append(h.samples[key][field], sample)
+	windowStart := sample.Time.Add(-window)
+	// the last sample before the window still holds at its start, so a sample is only evicted once the next one has
+	// left the window
+	for len(samples) > h.size && (window <= 0 || !samples[1].Time.After(windowStart)) {
+		samples = samples[1:]
+	}
+	h.samples[key][field] = samples
+}
+
+// get returns a copy of the history of the given field
+func (h *history) get(key string, field string) []models.Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]models.Sample, len(h.samples[key][field]))
+	copy(samples, h.samples[key][field])
+	return samples
+}
+
+// remove forgets the history of every field of the given key
+func (h *history) remove(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.samples, key)
+}
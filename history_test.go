@@ -0,0 +1,25 @@
+package framework
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestHistoryKeepsWindow(t *testing.T) {
+	h := newHistory(2)
+	start := time.Unix(0, 0)
+	for i := 0; i < 10; i++ {
+		h.record("A", "price", models.Sample{Time: start.Add(time.Duration(i) * time.Minute), Value: float64(i)}, 5*time.Minute)
+		h.record("A", "volume", models.Sample{Time: start.Add(time.Duration(i) * time.Minute), Value: float64(i)}, 0)
+	}
+
+	// the sample at minute 4 still holds at the start of the window
+	if samples := h.get("A", "price"); len(samples) != 6 || samples[0].Value != 4 {
+		t.Errorf("Expected the history to cover the window, got %v", samples)
+	}
+	if samples := h.get("A", "volume"); len(samples) != 2 || samples[0].Value != 8 {
+		t.Errorf("Expected the history to be limited to its size without a window, got %v", samples)
+	}
+}
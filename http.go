@@ -0,0 +1,174 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// httpShutdownTimeout is how long the HTTP server waits for in-flight requests when Run returns
+	httpShutdownTimeout = 5 * time.Second
+	// readinessTimeout bounds the DFX calls made by a readiness check
+	readinessTimeout = 10 * time.Second
+	// readinessCacheTTL is how long the outcome of the DFX calls made by a readiness check is reused, so that frequent
+	// or concurrent probes don't each start DFX processes
+	readinessCacheTTL = 5 * time.Second
+)
+
+// Handler returns the oracle's HTTP endpoints, for serving them from another server:
+//
+//	/healthz  liveness, always 200 while the process is serving requests
+//	/readyz   readiness, 200 if the canister is bootstrapped and running and the writer role is confirmed
+//	/status   the ServiceStatus of the oracle, as JSON
+//	/metrics  Prometheus metrics
+func (o *Oracle) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", o.serveReadiness)
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, o.ServiceStatus())
+	})
+	mux.Handle("/metrics", o.metrics.registry)
+	return mux
+}
+
+// readiness is the response of /readyz, with the outcome of each check ("ok" or an error message)
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// canisterChecks are the outcomes of the readiness checks that call DFX
+type canisterChecks struct {
+	checked   time.Time
+	installed bool
+	canister  error
+	writer    error
+}
+
+// readinessCache caches canisterChecks for readinessCacheTTL; mu is held while they run, so that concurrent probes
+// wait for the same checks
+type readinessCache struct {
+	mu   sync.Mutex
+	last *canisterChecks
+}
+
+// canisterChecks returns the outcomes of the readiness checks that call DFX, running them unless they ran recently
+func (o *Oracle) canisterChecks() *canisterChecks {
+	o.readiness.mu.Lock()
+	defer o.readiness.mu.Unlock()
+	if last := o.readiness.last; last != nil && time.Since(last.checked) < readinessCacheTTL {
+		return last
+	}
+	// not the request's context, so that a probe that gives up doesn't fail the checks shared with other probes
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+
+	checks := &canisterChecks{}
+	running, installed, err := o.dfxService.canisterStateContext(ctx)
+	if err == nil && !running {
+		err = fmt.Errorf("Canister is not running")
+	}
+	checks.installed, checks.canister = installed, err
+	isWriter, err := o.dfxService.hasWriterRole(ctx)
+	if err == nil && !isWriter {
+		err = fmt.Errorf("Writer identity %s does not have the writer role", o.dfxService.currentWriterIdentity())
+	}
+	checks.writer = err
+	checks.checked = time.Now()
+	o.readiness.last = checks
+	return checks
+}
+
+func (o *Oracle) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	result := readiness{Ready: true, Checks: make(map[string]string)}
+	check := func(name string, err error) {
+		if err != nil {
+			result.Ready = false
+			result.Checks[name] = err.Error()
+		} else {
+			result.Checks[name] = "ok"
+		}
+	}
+
+	checks := o.canisterChecks()
+	switch {
+	case o.bootstrap.incomplete():
+		check("bootstrap", fmt.Errorf("Bootstrap has not completed"))
+	case !o.bootstrap.started() && !checks.installed:
+		check("bootstrap", fmt.Errorf("Bootstrap has not run, and the canister is not installed"))
+	default:
+		check("bootstrap", nil)
+	}
+	check("canister", checks.canister)
+	check("writer_role", checks.writer)
+
+	status := http.StatusOK
+	if !result.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// startHTTPServer serves the given handler on the given address in the background, returning a function that shuts
+// the server down. Addresses of the form "unix:/path/to/socket" listen on a Unix socket that only the current user can
+// connect to.
+func (o *Oracle) startHTTPServer(name string, address string, handler http.Handler) (func(), error) {
+	listener, err := listen(address)
+	if err != nil {
+		return nil, fmt.Errorf("Could not listen on %s: %w", address, err)
+	}
+	server := &http.Server{Handler: handler}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			o.log.WithError(err).Errorf("%s server failed", name)
+		}
+	}()
+	o.log.Infof("Serving %s on %s", name, address)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+		<-served
+	}, nil
+}
+
+func listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		return net.Listen("tcp", address)
+	}
+	path := strings.TrimPrefix(address, "unix:")
+	// remove the socket left behind by a previous process that didn't shut down cleanly
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
@@ -0,0 +1,135 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestReadiness(t *testing.T) {
+	_, restore := fakeDfx(t, `case "$*" in
+*status*) printf "Canister .'s status is Running.\nModule hash: 0x2b1e\n" ;;
+*my_role*) echo "(opt variant { writer })" ;;
+esac`)
+	defer restore()
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, &models.Engine{})
+
+	recorder := httptest.NewRecorder()
+	o.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected the oracle to be ready, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	// the writer role has since been revoked, and the cached checks have expired
+	_, restore = fakeDfx(t, `case "$*" in
+*status*) printf "Canister .'s status is Running.\nModule hash: 0x2b1e\n" ;;
+*my_role*) echo "(null)" ;;
+esac`)
+	defer restore()
+	o.readiness.last = nil
+	recorder = httptest.NewRecorder()
+	o.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	var result readiness
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+	if recorder.Code != http.StatusServiceUnavailable || result.Ready || result.Checks["canister"] != "ok" ||
+		result.Checks["writer_role"] != "Writer identity writer does not have the writer role" {
+		t.Errorf("Expected the oracle to be unready without the writer role, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestReadinessRequiresInstalledCanister(t *testing.T) {
+	dir, restore := fakeDfx(t, `echo "$@" >> calls
+case "$*" in
+*status*) printf "Canister .'s status is Running.\nModule hash: None\n" ;;
+*my_role*) echo "(opt variant { writer })" ;;
+esac`)
+	defer restore()
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, &models.Engine{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := httptest.NewRecorder()
+			o.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/readyz", nil))
+			var result readiness
+			json.Unmarshal(recorder.Body.Bytes(), &result)
+			if recorder.Code != http.StatusServiceUnavailable || result.Checks["bootstrap"] != "Bootstrap has not run, and the canister is not installed" {
+				t.Errorf("Expected the oracle to be unready before the canister is installed, got %d %s", recorder.Code, recorder.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls, _ := ioutil.ReadFile(filepath.Join(dir, "calls")); strings.Count(string(calls), "\n") != 2 {
+		t.Errorf("Expected concurrent probes to share one status and one role check, got:\n%s", calls)
+	}
+}
+
+func TestStatusReportsKeyOutcomes(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"v": 1.5}`))
+	}))
+	defer good.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "good", Endpoints: []models.Endpoint{{Endpoint: good.URL, JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "bad", Endpoints: []models.Endpoint{{Endpoint: good.URL, JSONPaths: map[string]string{"v": "$.missing"}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, engine)
+	o.RunOnce(context.Background())
+
+	recorder := httptest.NewRecorder()
+	o.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/status", nil))
+	var status ServiceStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Could not decode status %s: %v", recorder.Body, err)
+	}
+	if status.Running || status.LastRoundStart == nil || status.LastRoundEnd == nil || len(status.Keys) != 2 {
+		t.Fatalf("Incorrect status %s", recorder.Body)
+	}
+	bad, published := status.Keys[0], status.Keys[1]
+	if bad.Key != "bad" || bad.Success || bad.Error == "" || bad.PublishedAt != nil {
+		t.Errorf("Incorrect status for failed key %+v", bad)
+	}
+	if published.Key != "good" || !published.Success || published.PublishedValues["v"] != 1.5 || published.PublishedAt == nil {
+		t.Errorf("Incorrect status for published key %+v", published)
+	}
+}
+
+func TestStartHTTPServerOnUnixSocket(t *testing.T) {
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, &models.Engine{})
+	socket := filepath.Join(tempDir(t), "oracle.sock")
+	stop, err := o.startHTTPServer("test", "unix:"+socket, o.Handler())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a socket only the current user can connect to, got %v, %v", info, err)
+	}
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	}}}
+	response, err := client.Get("http://oracle/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("Expected healthz to succeed, got %d", response.StatusCode)
+	}
+}
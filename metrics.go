@@ -0,0 +1,202 @@
+package framework
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/metrics"
+	"github.com/hyplabs/dfinity-oracle-framework/ratelimit"
+)
+
+// oracleMetrics are the Prometheus metrics of an oracle, served by its HTTP server at /metrics
+type oracleMetrics struct {
+	registry *metrics.Registry
+
+	roundDuration    *metrics.Histogram
+	fetchDuration    *metrics.Histogram
+	fetches          *metrics.Counter
+	coalesced        *metrics.Counter
+	cached           *metrics.Counter
+	rejected         *metrics.Counter
+	publishedValue   *metrics.Gauge
+	publishedTime    *metrics.Gauge
+	dfxCallDuration  *metrics.Histogram
+	dfxCallFailures  *metrics.Counter
+	stalenessSeconds *metrics.Gauge
+	quotaUsed        *metrics.Gauge
+	quotaLimit       *metrics.Gauge
+
+	mu              sync.Mutex
+	lastPublished   map[string]time.Time
+	publishedFields map[string]map[string]bool
+}
+
+func newOracleMetrics() *oracleMetrics {
+	r := metrics.NewRegistry()
+	m := &oracleMetrics{
+		registry: r,
+		roundDuration: r.NewHistogram("oracle_round_duration_seconds",
+			"Duration of update rounds.", metrics.DefaultBuckets),
+		fetchDuration: r.NewHistogram("oracle_endpoint_fetch_duration_seconds",
+			"Duration of requests to API endpoints.", metrics.DefaultBuckets, "key", "endpoint"),
+		fetches: r.NewCounter("oracle_endpoint_fetches_total",
+			"Requests to API endpoints, by result (\"success\" or the class of the error).", "key", "endpoint", "result"),
+		coalesced: r.NewCounter("oracle_endpoint_fetches_coalesced_total",
+			"Requests to API endpoints that shared the response of an identical request in the same round.", "key", "endpoint"),
+		cached: r.NewCounter("oracle_endpoint_cached_responses_total",
+			"Responses of API endpoints reused from the cache, by reason (\"fresh\" or \"not_modified\").", "key", "endpoint", "reason"),
+		rejected: r.NewCounter("oracle_rejected_values_total",
+			"Values discarded by summarizers, e.g. as outliers.", "key", "field"),
+		publishedValue: r.NewGauge("oracle_published_value",
+			"Last value written to the canister.", "key", "field"),
+		publishedTime: r.NewGauge("oracle_published_timestamp_seconds",
+			"Unix time of the last write to the canister.", "key", "field"),
+		dfxCallDuration: r.NewHistogram("oracle_dfx_call_duration_seconds",
+			"Duration of DFX commands.", metrics.DefaultBuckets, "command"),
+		dfxCallFailures: r.NewCounter("oracle_dfx_call_failures_total",
+			"DFX commands that failed.", "command"),
+		stalenessSeconds: r.NewGauge("oracle_staleness_seconds",
+			"Seconds since the value of a key was last written to the canister.", "key"),
+		quotaUsed: r.NewGauge("oracle_quota_used_requests",
+			"Requests counted against a quota in its current period.", "limit", "period"),
+		quotaLimit: r.NewGauge("oracle_quota_limit_requests",
+			"Requests allowed by a quota per period.", "limit", "period"),
+		lastPublished:   make(map[string]time.Time),
+		publishedFields: make(map[string]map[string]bool),
+	}
+	r.OnCollect(m.updateStaleness)
+	return m
+}
+
+func (m *oracleMetrics) observeRound(duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.roundDuration.Observe(duration.Seconds())
+}
+
+// observeFetch records a request to an endpoint, with the class of its error if it failed
+func (m *oracleMetrics) observeFetch(key string, endpoint string, duration time.Duration, result string) {
+	if m == nil {
+		return
+	}
+	endpoint = endpointLabel(endpoint)
+	m.fetchDuration.Observe(duration.Seconds(), key, endpoint)
+	m.fetches.Inc(key, endpoint, result)
+}
+
+func (m *oracleMetrics) observeCoalesced(key string, endpoint string) {
+	if m == nil {
+		return
+	}
+	m.coalesced.Inc(key, endpointLabel(endpoint))
+}
+
+func (m *oracleMetrics) observeCached(key string, endpoint string, reason string) {
+	if m == nil {
+		return
+	}
+	m.cached.Inc(key, endpointLabel(endpoint), reason)
+}
+
+func (m *oracleMetrics) observeRejected(key string, field string, rejected int) {
+	if m == nil {
+		return
+	}
+	m.rejected.Add(float64(rejected), key, field)
+}
+
+func (m *oracleMetrics) observePublished(key string, values map[string]float64, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.publishedFields[key] == nil {
+		m.publishedFields[key] = make(map[string]bool)
+	}
+	for field, value := range values {
+		m.publishedValue.Set(value, key, field)
+		m.publishedTime.Set(float64(now.UnixNano())/1e9, key, field)
+		m.publishedFields[key][field] = true
+	}
+	m.lastPublished[key] = now
+}
+
+// forgetKey deletes the published value and staleness series of a key that was removed
+func (m *oracleMetrics) forgetKey(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for field := range m.publishedFields[key] {
+		m.publishedValue.Delete(key, field)
+		m.publishedTime.Delete(key, field)
+	}
+	m.stalenessSeconds.Delete(key)
+	delete(m.publishedFields, key)
+	delete(m.lastPublished, key)
+}
+
+func (m *oracleMetrics) observeQuotas(usage []ratelimit.Usage) {
+	if m == nil {
+		return
+	}
+	for _, u := range usage {
+		m.quotaUsed.Set(float64(u.Used), u.Name, string(u.Period))
+		m.quotaLimit.Set(float64(u.Limit), u.Name, string(u.Period))
+	}
+}
+
+func (m *oracleMetrics) observeDfxCall(args []string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	command := dfxCommandName(args)
+	m.dfxCallDuration.Observe(duration.Seconds(), command)
+	if err != nil {
+		m.dfxCallFailures.Inc(command)
+	}
+}
+
+func (m *oracleMetrics) updateStaleness() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, published := range m.lastPublished {
+		m.stalenessSeconds.Set(time.Since(published).Seconds(), key)
+	}
+}
+
+// endpointLabel returns the endpoint URL without its query string or credentials, which often contain API keys
+func endpointLabel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "invalid"
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// dfxCommandName returns a short name for a DFX command, such as "canister call update_map_value", leaving out
+// options and arguments so that the number of distinct names stays small
+func dfxCommandName(args []string) string {
+	var words []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--identity" || args[i] == "--network" {
+			i++
+		} else if !strings.HasPrefix(args[i], "-") {
+			words = append(words, args[i])
+		}
+	}
+	switch {
+	case len(words) >= 4 && words[0] == "canister" && words[1] == "call":
+		return "canister call " + words[3]
+	case len(words) >= 2 && (words[0] == "canister" || words[0] == "identity"):
+		return strings.Join(words[:2], " ")
+	case len(words) >= 1:
+		return words[0]
+	}
+	return ""
+}
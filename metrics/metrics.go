@@ -0,0 +1,230 @@
+// Package metrics implements counters, gauges and histograms exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suited to request latencies, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Registry holds metric families and writes them in the Prometheus text exposition format
+type Registry struct {
+	mu         sync.Mutex
+	families   []*family
+	collectors []func()
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnCollect registers a function that is called before every scrape, e.g. to update gauges computed from other state
+func (r *Registry) OnCollect(collect func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collect)
+}
+
+// NewCounter registers a counter with the given label names
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", nil, labels)}
+}
+
+// NewGauge registers a gauge with the given label names
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", nil, labels)}
+}
+
+// NewHistogram registers a histogram with the given buckets (upper bounds, in increasing order) and label names
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(name, help, "histogram", buckets, labels)}
+}
+
+func (r *Registry) register(name string, help string, kind string, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		if f.name == name {
+			panic(fmt.Sprintf("metric %s is already registered", name))
+		}
+	}
+	f := &family{name: name, help: help, kind: kind, buckets: buckets, labels: labels, series: make(map[string]*series)}
+	r.families = append(r.families, f)
+	return f
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]func(){}, r.collectors...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+	for _, collect := range collectors {
+		collect()
+	}
+
+	var out strings.Builder
+	for _, f := range families {
+		f.write(&out)
+	}
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics of the registry
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// Counter is a metric that only goes up
+type Counter struct{ f *family }
+
+// Add adds the given amount to the counter with the given label values
+func (c *Counter) Add(amount float64, labelValues ...string) {
+	c.f.update(labelValues, func(s *series) { s.value += amount })
+}
+
+// Inc adds one to the counter with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge is a metric that can be set to any value
+type Gauge struct{ f *family }
+
+// Set sets the gauge with the given label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value = value })
+}
+
+// Delete removes the gauge with the given label values
+func (g *Gauge) Delete(labelValues ...string) {
+	g.f.delete(labelValues)
+}
+
+// Histogram is a metric that counts observations in buckets
+type Histogram struct{ f *family }
+
+// Observe records a value in the histogram with the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.f.update(labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, bound := range h.f.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.value += value
+	})
+}
+
+type family struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	kind    string
+	buckets []float64
+	labels  []string
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64 // the value of counters and gauges, or the sum of histogram observations
+	count       uint64
+	counts      []uint64
+}
+
+func (f *family) update(labelValues []string, update func(*series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		f.series[key] = s
+	}
+	update(s)
+}
+
+func (f *family) delete(labelValues []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.series, strings.Join(labelValues, "\xff"))
+}
+
+func (f *family) write(out *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(out, "%s%s %s\n", f.name, f.labelString(s.labelValues, ""), formatValue(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(out, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(out, "%s_sum%s %s\n", f.name, f.labelString(s.labelValues, ""), formatValue(s.value))
+		fmt.Fprintf(out, "%s_count%s %d\n", f.name, f.labelString(s.labelValues, ""), s.count)
+	}
+}
+
+// labelString formats the labels of a series, adding the "le" label of a histogram bucket if given
+func (f *family) labelString(labelValues []string, le string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, value := range labelValues {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", f.labels[i], escapeLabelValue(value)))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n").Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\"", "\\\"").Replace(value)
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesTextFormat(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests.", "host", "result")
+	temperature := r.NewGauge("temperature", "Temperature.\nIn celsius.")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	collected := 0
+	r.OnCollect(func() {
+		collected++
+		temperature.Set(21.5)
+	})
+
+	requests.Inc("example.com", "success")
+	requests.Add(2, "example.com", "success")
+	requests.Inc("example.com", `"timeout"`)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{host="example.com",result="\"timeout\""} 1
+requests_total{host="example.com",result="success"} 3
+# HELP temperature Temperature.\nIn celsius.
+# TYPE temperature gauge
+temperature 21.5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+`
+	if recorder.Body.String() != expected {
+		t.Errorf("Incorrect metrics:\n%s", recorder.Body.String())
+	}
+	if collected != 1 {
+		t.Errorf("Expected collectors to run once per scrape, ran %d times", collected)
+	}
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Incorrect content type %s", recorder.Header().Get("Content-Type"))
+	}
+}
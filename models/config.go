@@ -1,9 +1,131 @@
 package models
 
-import "time"
+import (
+	"net/url"
+	"strings"
+	"time"
+)
 
 // Config is the configuration for the oracle to be made
 type Config struct {
 	CanisterName   string
 	UpdateInterval time.Duration
+	HistorySize    int // number of previous values kept per field for smoothing, defaults to 1024; see SmoothedField.Window
+	// MaxConcurrentKeys is how many keys are updated in parallel in a round, defaults to 4. A derived key waits for its
+	// dependencies in the same round, and a key is never updated by more than one round at a time.
+	MaxConcurrentKeys int
+	// MaxConcurrentRequests is how many requests to endpoints may be in flight at once, defaults to 32
+	MaxConcurrentRequests int
+	// MaxRequestsPerHost is how many requests to endpoints on the same host may be in flight at once, defaults to 4
+	MaxRequestsPerHost int
+	// RateLimits limit the rate of requests to endpoints, by host or by group, and budget them against quotas
+	RateLimits []RateLimit
+	// QuotaFile, if set, is where the number of requests counted against quotas is kept across restarts
+	QuotaFile string
+	// Transport is the default TLS and proxy configuration of requests to endpoints
+	Transport *Transport
+	// ShutdownGracePeriod is how long an update round in progress may take to finish when the oracle is stopped,
+	// defaults to 30 seconds
+	ShutdownGracePeriod time.Duration
+	// UnmanagedReplica stops Bootstrap from ever starting the local network; it must already be running
+	UnmanagedReplica bool
+	// HTTPAddress, if set, is the address (e.g. ":9090") that Run serves the oracle's HTTP endpoints on, such as
+	// Prometheus metrics at /metrics
+	HTTPAddress string
+	// AdminAddress, if set, is the address that Run serves the admin API on, either a TCP address such as
+	// "127.0.0.1:9091" or a Unix socket such as "unix:/run/oracle/admin.sock"
+	AdminAddress string
+	// AdminToken is the bearer token required by the admin API; it must be set if AdminAddress is a TCP address
+	AdminToken string
+	// ReplicaReadyTimeout is how long Bootstrap waits for the local network to become ready after starting it,
+	// defaults to 60 seconds
+	ReplicaReadyTimeout time.Duration
+	// ProjectDir is the directory of the generated DFX project, defaults to CanisterName in the working directory
+	ProjectDir string
+	// CanisterTemplateFile, if set, is a text/template file layered over the default canister code template, either
+	// overriding its extension blocks or replacing it entirely
+	CanisterTemplateFile string
+	// Networks are additional networks written to dfx.json, mapping each network name to its provider URL
+	Networks map[string]string
+	// CanisterSettings are optional settings for the canister, written to dfx.json
+	CanisterSettings CanisterSettings
+	// Network is the network to deploy to and write to: "local" (the default), "ic" for the Internet Computer
+	// mainnet, another network named in dfx.json, or a provider URL
+	Network string
+	// OwnerIdentity is the DFX identity that owns the canister, defaults to the currently selected identity
+	OwnerIdentity string
+	// WriterIdentity is the DFX identity that writes values to the canister, defaults to "writer"; the identity recorded
+	// by Oracle.RotateWriter takes precedence
+	WriterIdentity string
+	// WriterPEMFile, if set, is imported as the writer identity instead of generating a new key
+	WriterPEMFile string
+	// AllowMainnetDestructiveOperations must be set to self-destruct the canister, or to revoke or rotate writers, on mainnet
+	AllowMainnetDestructiveOperations bool
+}
+
+// MainnetNetwork is the name of the Internet Computer mainnet in DFX
+const MainnetNetwork = "ic"
+
+// IsLocalNetwork returns whether the configured network is the local network, which the oracle may start itself
+func (c *Config) IsLocalNetwork() bool {
+	return c.Network == "" || c.Network == "local"
+}
+
+// mainnetDomains are the domains of the Internet Computer mainnet's boundary nodes
+var mainnetDomains = []string{"ic0.app", "icp0.io", "icp-api.io"}
+
+// IsMainnet returns whether the configured network is the Internet Computer mainnet: "ic", a mainnet provider URL such
+// as https://icp0.io, or a network in Networks whose provider is one. Any other named network is treated as mainnet,
+// since its provider is unknown; IsMainnetNetwork also resolves networks defined in the project's dfx.json.
+func (c *Config) IsMainnet() bool {
+	return c.IsMainnetNetwork(nil)
+}
+
+// IsMainnetNetwork is like IsMainnet, but resolves a named network that isn't in Networks from the given providers of
+// each network defined elsewhere, such as in the project's dfx.json. A named network that can't be resolved is treated
+// as mainnet.
+func (c *Config) IsMainnetNetwork(providers map[string][]string) bool {
+	if c.IsLocalNetwork() {
+		return false
+	}
+	if c.Network == MainnetNetwork {
+		return true
+	}
+	if provider, ok := c.Networks[c.Network]; ok {
+		return IsMainnetProvider(provider)
+	}
+	if u, err := url.Parse(c.Network); err == nil && u.Scheme != "" {
+		return IsMainnetProvider(c.Network)
+	}
+	resolved, ok := providers[c.Network]
+	if !ok {
+		return true
+	}
+	for _, provider := range resolved {
+		if IsMainnetProvider(provider) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsMainnetProvider returns whether the given provider URL is a boundary node of the Internet Computer mainnet
+func IsMainnetProvider(provider string) bool {
+	u, err := url.Parse(strings.TrimSpace(provider))
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	for _, domain := range mainnetDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanisterSettings are optional settings for the oracle canister
+type CanisterSettings struct {
+	ComputeAllocation int    // percentage of compute capacity reserved for the canister, from 0 to 100
+	MemoryAllocation  string // memory reserved for the canister, such as "2GB"
 }
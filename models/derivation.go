@@ -0,0 +1,12 @@
+package models
+
+// Derivation computes the fields of a key from the latest summarized values of other keys, instead of retrieving them
+// from endpoints. Keys on the same schedule are updated in the same round, dependencies first.
+type Derivation struct {
+	// Expressions maps each derived field to an expression over other keys' fields, written as "key.field" (or
+	// "[key].field" for keys that aren't identifiers), e.g. "[ETH/USD].price / [BTC/USD].price"
+	Expressions map[string]string
+	// Func computes derived fields from the latest summarized values of the keys in DependsOn, indexed by key then field
+	Func      func(map[string]map[string]float64) (map[string]float64, error)
+	DependsOn []string
+}
@@ -1,8 +1,27 @@
 package models
 
+import "time"
+
 // Endpoint is an endpoint configuration for the oracle
 type Endpoint struct {
-	Endpoint      string
+	Endpoint string
+	// Method is the HTTP method of requests to the endpoint, defaults to GET
+	Method string
+	// Headers are added to requests to the endpoint, e.g. for API keys that aren't passed in the URL
+	Headers map[string]string
+	// Body, if set, is sent as the body of requests to the endpoint
+	Body string
+	// MinRefresh is the minimum time between requests to the endpoint; until it has passed, the previous response is
+	// used again, e.g. for sources that only update hourly. Responses are also reused while their Cache-Control
+	// headers allow.
+	MinRefresh time.Duration
+	// Transport, if set, overrides the TLS and proxy settings of Config.Transport for requests to the endpoint
+	Transport *Transport
+	// Group names the group of endpoints this endpoint is in, for a RateLimit that applies to the group
+	Group         string
 	JSONPaths     map[string]string
 	NormalizeFunc func(map[string]interface{}) (map[string]float64, error)
+	// Expressions computes each resulting field from the values extracted by JSONPaths, e.g. "(bid + ask) / 2" or
+	// "f_to_c(temp_f)", as an alternative to NormalizeFunc; see the expr package for the syntax
+	Expressions map[string]string
 }
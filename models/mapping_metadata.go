@@ -1,8 +1,26 @@
 package models
 
+// SummaryFunc combines the values retrieved from every endpoint into a single value per field
+type SummaryFunc func([]map[string]float64) map[string]float64
+
 // MappingMetadata is the data required for the smart contract to store arbitrary key-values
 type MappingMetadata struct {
 	Key         string
-	SummaryFunc func([]map[string]float64) map[string]float64
-	Endpoints   []Endpoint
+	SummaryFunc SummaryFunc
+	// DetailedSummaryFunc takes precedence over SummaryFunc, and also reports how much the sources agreed
+	DetailedSummaryFunc DetailedSummaryFunc
+	// FieldSummaryFuncs overrides SummaryFunc for individual fields; fields not listed here fall back to SummaryFunc
+	FieldSummaryFuncs map[string]SummaryFunc
+	// FieldDetailedSummaryFuncs overrides FieldSummaryFuncs for individual fields
+	FieldDetailedSummaryFuncs map[string]DetailedSummaryFunc
+	// PublishSummaryStats also writes the dispersion metadata of every field to the canister, as extra fields named
+	// after the summarized field (e.g. "price_sources", "price_stddev", "price_ci_low")
+	PublishSummaryStats bool
+	// SmoothedFields publishes fields smoothed over previous rounds, in addition to or instead of their spot values
+	SmoothedFields []SmoothedField
+	Endpoints      []Endpoint
+	// Derived computes this key from the latest values of other keys; Endpoints and summarizers are ignored if it is set
+	Derived *Derivation
+	// Schedule, if set, updates this key on its own schedule rather than at Config.UpdateInterval
+	Schedule *Schedule
 }
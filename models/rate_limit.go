@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RateLimit limits requests to the endpoints on a host, or to the endpoints in a group, e.g. to stay within the limits
+// of a paid data provider
+type RateLimit struct {
+	// Host applies the limit to every endpoint on a host, e.g. "api.weatherapi.com"; Group applies it to every endpoint
+	// with that Group instead. Exactly one of them must be set.
+	Host  string
+	Group string
+	// Requests is the number of requests allowed per Per (a minute by default), in bursts of up to Burst requests
+	// (Requests by default); requests beyond that wait their turn
+	Requests int
+	Per      time.Duration
+	Burst    int
+	// DailyQuota and MonthlyQuota are the number of requests allowed per calendar day or month in UTC. Requests are
+	// paced to make a quota last until the end of its period, skipping the endpoint in rounds that would use more than
+	// its share, and a warning is logged when most of a quota is used.
+	DailyQuota   int
+	MonthlyQuota int
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Schedule is when a key is updated, if not at Config.UpdateInterval along with every other key
+type Schedule struct {
+	// Interval updates the key at its own interval; if neither it nor Cron is set, Config.UpdateInterval is used
+	Interval time.Duration
+	// Cron updates the key at the times given by a five-field cron expression instead, e.g. "5 0 * * *" for 00:05 every
+	// day; see schedule.ParseCron for the syntax
+	Cron string
+	// Timezone is the IANA name of the time zone Cron is evaluated in, e.g. "Europe/Zurich", defaults to UTC
+	Timezone string
+	// Jitter delays every update by a random duration of up to Jitter, to spread out requests to upstreams shared with
+	// other keys or oracles
+	Jitter time.Duration
+}
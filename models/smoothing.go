@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Sample is a summarized field value published in a previous round
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// SmoothingFunc combines the samples of a field, oldest first, into a single value as of the given time
+type SmoothingFunc func(samples []Sample, now time.Time) float64
+
+// SmoothedField publishes a field smoothed over previous rounds, such as a time-weighted or exponential moving average
+type SmoothedField struct {
+	Field         string // summarized field to smooth
+	Name          string // field name to publish the smoothed value under; if empty, it replaces the spot value of Field
+	SmoothingFunc SmoothingFunc
+	// Window is how far back SmoothingFunc looks, such as the window of a TWAP. The history of Field is kept for at
+	// least the largest Window of its smoothed fields, even beyond models.Config.HistorySize samples
+	Window time.Duration
+}
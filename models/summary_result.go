@@ -0,0 +1,18 @@
+package models
+
+// SummaryResult is a summarized field value along with how much the sources agreed on it
+type SummaryResult struct {
+	Value    float64
+	Sources  int // number of values that were used to compute Value
+	Rejected int // number of values that were discarded, e.g. as outliers
+	StdDev   float64
+	Min      float64
+	Max      float64
+	// ConfidenceLow and ConfidenceHigh bound a 95% confidence interval around Value, 1.96 standard errors of the mean of
+	// the values used either side of it
+	ConfidenceLow  float64
+	ConfidenceHigh float64
+}
+
+// DetailedSummaryFunc combines the values retrieved from every endpoint into a single result per field
+type DetailedSummaryFunc func([]map[string]float64) map[string]SummaryResult
@@ -0,0 +1,21 @@
+package models
+
+// Transport configures how requests to endpoints are sent: the TLS settings used to connect to them and the proxy they
+// are sent through. Every setting is optional; an endpoint's Transport overrides the settings of Config.Transport that
+// it sets, and keeps the others.
+type Transport struct {
+	// RootCAFiles are PEM files of the certificate authorities trusted to verify the endpoint, instead of the system's
+	RootCAFiles []string
+	// ClientCertFile and ClientKeyFile are PEM files of the certificate and key presented to endpoints that require
+	// client certificates (mutual TLS); both must be set
+	ClientCertFile string
+	ClientKeyFile  string
+	// MinTLSVersion is the minimum TLS version accepted: "1.0", "1.1", "1.2" or "1.3"
+	MinTLSVersion string
+	// PinnedKeys are base64 SHA-256 hashes of the public keys (SubjectPublicKeyInfo) that the endpoint's certificate
+	// chain must contain one of, optionally prefixed with "sha256/"
+	PinnedKeys []string
+	// ProxyURL is the URL of the HTTP, HTTPS or SOCKS5 proxy requests are sent through, instead of the proxy given by
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	ProxyURL string
+}
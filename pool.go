@@ -0,0 +1,140 @@
+package framework
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+)
+
+// Defaults of the concurrency limits of models.Config
+const (
+	defaultMaxConcurrentKeys     = 4
+	defaultMaxConcurrentRequests = 32
+	defaultMaxRequestsPerHost    = 4
+)
+
+// requestLimiter bounds the number of requests to endpoints in flight, overall and per host
+type requestLimiter struct {
+	total   chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func newRequestLimiter(total int, perHost int) *requestLimiter {
+	if total <= 0 {
+		total = defaultMaxConcurrentRequests
+	}
+	if perHost <= 0 {
+		perHost = defaultMaxRequestsPerHost
+	}
+	return &requestLimiter{total: make(chan struct{}, total), perHost: perHost, hosts: make(map[string]chan struct{})}
+}
+
+// acquire waits until a request to the given endpoint may be sent, returning a function to call once it is done, or an
+// error if the given context is cancelled first
+func (l *requestLimiter) acquire(ctx context.Context, endpoint string) (func(), error) {
+	host := l.host(endpoint)
+	// the host's slot is taken first, so that requests waiting for a busy host don't hold up requests to other hosts
+	select {
+	case host <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case l.total <- struct{}{}:
+	case <-ctx.Done():
+		<-host
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-l.total
+		<-host
+	}, nil
+}
+
+func (l *requestLimiter) host(endpoint string) chan struct{} {
+	var name string
+	if u, err := url.Parse(endpoint); err == nil {
+		name = u.Host
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	host, ok := l.hosts[name]
+	if !ok {
+		host = make(chan struct{}, l.perHost)
+		l.hosts[name] = host
+	}
+	return host
+}
+
+// updateKeysConcurrently updates the given keys, which are in the order of the round plan, with up to
+// models.Config.MaxConcurrentKeys workers. Each key is updated by a single worker, and a derived key waits until its
+// dependencies in the same round have been updated. Identical requests to endpoints are only sent once per round.
+// Keys not yet started when the given context is cancelled are skipped. It returns the keys that failed or were
+// skipped, in plan order.
+func (o *Oracle) updateKeysConcurrently(ctx context.Context, plan *roundPlan, keys []models.MappingMetadata) []string {
+	workers := o.config.MaxConcurrentKeys
+	if workers <= 0 {
+		workers = defaultMaxConcurrentKeys
+	}
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	done := make(map[string]chan struct{}, len(keys))
+	for _, meta := range keys {
+		done[meta.Key] = make(chan struct{})
+	}
+	var failedMu sync.Mutex
+	failed := make(map[string]bool)
+
+	// keys are dispatched in plan order, so the dependencies of a derived key have already been picked up by other
+	// workers, which never wait for keys later in the plan
+	requests := utils.NewRequestGroup()
+	jobs := make(chan models.MappingMetadata)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for meta := range jobs {
+				if d, ok := plan.derivations[meta.Key]; ok {
+					for _, dep := range d.dependsOn {
+						if depDone, ok := done[dep]; ok {
+							<-depDone
+						}
+					}
+				}
+				if err := o.updateKey(ctx, plan, meta, requests); err != nil {
+					failedMu.Lock()
+					failed[meta.Key] = true
+					failedMu.Unlock()
+				}
+				close(done[meta.Key])
+			}
+		}()
+	}
+	dispatched := 0
+	for _, meta := range keys {
+		if ctx.Err() != nil {
+			o.log.Errorf("Update round aborted before updating %s", meta.Key)
+			break
+		}
+		jobs <- meta
+		dispatched++
+	}
+	close(jobs)
+	wg.Wait()
+
+	var notUpdated []string
+	for i, meta := range keys {
+		if i >= dispatched || failed[meta.Key] {
+			notUpdated = append(notUpdated, meta.Key)
+		}
+	}
+	return notUpdated
+}
@@ -0,0 +1,125 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestRequestLimiterBoundsRequestsPerHost(t *testing.T) {
+	l := newRequestLimiter(2, 1)
+	ctx := context.Background()
+	releaseA, err := l.acquire(ctx, "http://a.example/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(timeout, "http://a.example/y"); err == nil {
+		t.Errorf("Expected a second request to the same host to wait")
+	}
+	releaseB, err := l.acquire(ctx, "http://b.example/x")
+	if err != nil {
+		t.Fatalf("Expected a request to another host to proceed, got %v", err)
+	}
+
+	// the total limit is reached, even for a new host
+	timeout, cancel = context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(timeout, "http://c.example/x"); err == nil {
+		t.Errorf("Expected a request beyond the total limit to wait")
+	}
+
+	releaseA()
+	releaseB()
+	if release, err := l.acquire(ctx, "http://a.example/y"); err != nil {
+		t.Errorf("Expected a request after release to proceed, got %v", err)
+	} else {
+		release()
+	}
+}
+
+func TestRoundUpdatesKeysConcurrently(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.Write([]byte(`{"v": 2}`))
+	}))
+	defer server.Close()
+	endpoint := func(path string) []models.Endpoint {
+		return []models.Endpoint{{Endpoint: server.URL + path, JSONPaths: map[string]string{"v": "$.v"}}}
+	}
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "sum", Derived: &models.Derivation{Expressions: map[string]string{"v": "a.v + b.v + c.v"}}},
+		{Key: "a", Endpoints: endpoint("/a")},
+		{Key: "b", Endpoints: endpoint("/b")},
+		{Key: "c", Endpoints: endpoint("/c")},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: ".", MaxConcurrentKeys: 3, MaxRequestsPerHost: 2}, engine)
+
+	o.RunOnce(context.Background())
+
+	if maxInFlight != 2 {
+		t.Errorf("Expected the per-host limit of 2 concurrent requests to be reached, got %d", maxInFlight)
+	}
+	for _, status := range o.ServiceStatus().Keys {
+		if !status.Success || (status.Key == "sum" && status.PublishedValues["v"] != 6) {
+			t.Errorf("Incorrect status %+v", status)
+		}
+	}
+}
+
+func TestRoundCoalescesIdenticalRequests(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.Write([]byte(`{"BTC": 60000, "ETH": 3000, "SOL": 150}`))
+	}))
+	defer server.Close()
+	var metadata []models.MappingMetadata
+	for _, coin := range []string{"BTC", "ETH", "SOL"} {
+		metadata = append(metadata, models.MappingMetadata{Key: coin, Endpoints: []models.Endpoint{{Endpoint: server.URL + "/ticker", JSONPaths: map[string]string{"price": "$." + coin}}}})
+	}
+	o := newTestOracle(t, &models.Config{CanisterName: "."}, &models.Engine{Metadata: metadata})
+
+	o.RunOnce(context.Background())
+	o.RunOnce(context.Background())
+
+	if requests != 2 {
+		t.Errorf("Expected one request per round, got %d", requests)
+	}
+	for _, status := range o.ServiceStatus().Keys {
+		if status.Key == "ETH" && status.PublishedValues["price"] != 3000 {
+			t.Errorf("Incorrect status %+v", status)
+		}
+	}
+	var out strings.Builder
+	o.metrics.registry.WriteTo(&out)
+	if !strings.Contains(out.String(), "oracle_endpoint_fetches_coalesced_total") {
+		t.Errorf("Expected coalesced requests to be counted:\n%s", out.String())
+	}
+}
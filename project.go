@@ -0,0 +1,168 @@
+package framework
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// dfxProject is the subset of the dfx.json format written by the framework
+type dfxProject struct {
+	Version   int                               `json:"version"`
+	Canisters map[string]dfxCanister            `json:"canisters"`
+	Defaults  map[string]map[string]string      `json:"defaults"`
+	Networks  map[string]map[string]interface{} `json:"networks"`
+}
+
+type dfxCanister struct {
+	Type                 string                 `json:"type"`
+	Main                 string                 `json:"main"`
+	InitializationValues map[string]interface{} `json:"initialization_values,omitempty"`
+}
+
+// projectDir returns the directory of the DFX project, which all DFX commands run in
+func (s *DFXService) projectDir() string {
+	if s.config.ProjectDir != "" {
+		return s.config.ProjectDir
+	}
+	return s.config.CanisterName
+}
+
+// candidFile returns the path of the Candid interface file written next to the canister code
+func (s *DFXService) candidFile() string {
+	return filepath.Join(s.projectDir(), "src", s.config.CanisterName, s.config.CanisterName+".did")
+}
+
+// writeDfxProject writes a minimal dfx.json for the oracle canister into the project directory, creating it if needed.
+// Unlike `dfx new`, this doesn't need network access and doesn't scaffold a frontend. If dfx.json already exists, the
+// oracle's canister and networks are merged into it, keeping any other canisters, networks and settings added to it.
+func (s *DFXService) writeDfxProject() error {
+	s.log.Infof("Writing DFX project %s...", s.projectDir())
+	if err := os.MkdirAll(s.projectDir(), 0755); err != nil {
+		s.log.WithError(err).Errorln("Could not create project directory")
+		return err
+	}
+	path := filepath.Join(s.projectDir(), "dfx.json")
+	contents, err := mergeDfxProject(path, s.dfxProject())
+	if err != nil {
+		s.log.WithError(err).Errorln("Could not merge dfx.json")
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(contents, '\n'), 0644); err != nil {
+		s.log.WithError(err).Errorln("Could not write dfx.json")
+		return err
+	}
+	return nil
+}
+
+// mergeDfxProject returns the contents of the dfx.json at path with the given project merged into it: the project's
+// canister and networks replace any entries of the same name, except that an existing local network is kept, and
+// the version and defaults are only set if they are missing
+func mergeDfxProject(path string, project dfxProject) ([]byte, error) {
+	existing, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return json.MarshalIndent(project, "", "  ")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var merged map[string]interface{}
+	if err := json.Unmarshal(existing, &merged); err != nil {
+		return nil, fmt.Errorf("Could not parse existing %s: %w", path, err)
+	}
+	if merged == nil {
+		merged = make(map[string]interface{})
+	}
+
+	var generated map[string]interface{}
+	data, err := json.Marshal(project)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal(data, &generated)
+	for _, section := range []string{"canisters", "networks"} {
+		entries, ok := merged[section].(map[string]interface{})
+		if !ok {
+			entries = make(map[string]interface{})
+			merged[section] = entries
+		}
+		for name, entry := range generated[section].(map[string]interface{}) {
+			if _, ok := entries[name]; ok && section == "networks" && name == "local" {
+				continue
+			}
+			entries[name] = entry
+		}
+	}
+	for _, key := range []string{"version", "defaults"} {
+		if _, ok := merged[key]; !ok {
+			merged[key] = generated[key]
+		}
+	}
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+// projectNetworks returns the providers of each network defined in the project's dfx.json, or nil if it can't be read.
+// A network without providers, such as one bound to a local address, has none; a network whose providers can't be
+// parsed is left out.
+func (s *DFXService) projectNetworks() map[string][]string {
+	contents, err := ioutil.ReadFile(filepath.Join(s.projectDir(), "dfx.json"))
+	if err != nil {
+		return nil
+	}
+	var project struct {
+		Networks map[string]json.RawMessage `json:"networks"`
+	}
+	if err := json.Unmarshal(contents, &project); err != nil {
+		return nil
+	}
+	networks := make(map[string][]string)
+	for name, entry := range project.Networks {
+		var network struct {
+			Providers []string `json:"providers"`
+		}
+		if err := json.Unmarshal(entry, &network); err != nil {
+			continue
+		}
+		networks[name] = network.Providers
+	}
+	return networks
+}
+
+func (s *DFXService) dfxProject() dfxProject {
+	canister := dfxCanister{
+		Type: "motoko",
+		Main: filepath.ToSlash(filepath.Join("src", s.config.CanisterName, "main.mo")),
+	}
+	settings := s.config.CanisterSettings
+	if settings.ComputeAllocation != 0 || settings.MemoryAllocation != "" {
+		canister.InitializationValues = make(map[string]interface{})
+		if settings.ComputeAllocation != 0 {
+			canister.InitializationValues["compute_allocation"] = settings.ComputeAllocation
+		}
+		if settings.MemoryAllocation != "" {
+			canister.InitializationValues["memory_allocation"] = settings.MemoryAllocation
+		}
+	}
+
+	networks := map[string]map[string]interface{}{
+		"local": {"bind": "127.0.0.1:8000", "type": "ephemeral"},
+	}
+	names := make([]string, 0, len(s.config.Networks))
+	for name := range s.config.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		networks[name] = map[string]interface{}{"providers": []string{s.config.Networks[name]}, "type": "persistent"}
+	}
+
+	return dfxProject{
+		Version:   1,
+		Canisters: map[string]dfxCanister{s.config.CanisterName: canister},
+		Defaults:  map[string]map[string]string{"build": {"packtool": ""}},
+		Networks:  networks,
+	}
+}
@@ -0,0 +1,83 @@
+package framework
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestDfxProject(t *testing.T) {
+	s := newTestDFXService(&models.Config{
+		CanisterName:     "weather_oracle",
+		Networks:         map[string]string{"staging": "https://staging.example.com"},
+		CanisterSettings: models.CanisterSettings{ComputeAllocation: 10},
+	})
+
+	contents, err := json.Marshal(s.dfxProject())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual, expected interface{}
+	json.Unmarshal(contents, &actual)
+	json.Unmarshal([]byte(`{
+		"version": 1,
+		"canisters": {"weather_oracle": {"type": "motoko", "main": "src/weather_oracle/main.mo", "initialization_values": {"compute_allocation": 10}}},
+		"defaults": {"build": {"packtool": ""}},
+		"networks": {
+			"local": {"bind": "127.0.0.1:8000", "type": "ephemeral"},
+			"staging": {"providers": ["https://staging.example.com"], "type": "persistent"}
+		}
+	}`), &expected)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Incorrect dfx.json %s", contents)
+	}
+}
+
+func TestWriteDfxProjectKeepsExistingEntries(t *testing.T) {
+	dir := tempDir(t)
+	existing := `{
+		"version": 1,
+		"dfx": "0.9.3",
+		"canisters": {
+			"frontend": {"type": "assets", "source": ["dist"]},
+			"weather_oracle": {"type": "motoko", "main": "old.mo"}
+		},
+		"networks": {
+			"local": {"bind": "127.0.0.1:4943", "type": "ephemeral"},
+			"testnet": {"providers": ["https://testnet.example.com"], "type": "persistent"}
+		}
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "dfx.json"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestDFXService(&models.Config{CanisterName: "weather_oracle", ProjectDir: dir, Networks: map[string]string{"staging": "https://staging.example.com"}})
+
+	if err := s.writeDfxProject(); err != nil {
+		t.Fatalf("Could not write dfx.json: %v", err)
+	}
+
+	contents, _ := ioutil.ReadFile(filepath.Join(dir, "dfx.json"))
+	var actual, expected interface{}
+	json.Unmarshal(contents, &actual)
+	json.Unmarshal([]byte(`{
+		"version": 1,
+		"dfx": "0.9.3",
+		"canisters": {
+			"frontend": {"type": "assets", "source": ["dist"]},
+			"weather_oracle": {"type": "motoko", "main": "src/weather_oracle/main.mo"}
+		},
+		"defaults": {"build": {"packtool": ""}},
+		"networks": {
+			"local": {"bind": "127.0.0.1:4943", "type": "ephemeral"},
+			"testnet": {"providers": ["https://testnet.example.com"], "type": "persistent"},
+			"staging": {"providers": ["https://staging.example.com"], "type": "persistent"}
+		}
+	}`), &expected)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Incorrect merged dfx.json %s", contents)
+	}
+}
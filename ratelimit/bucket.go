@@ -0,0 +1,62 @@
+// Package ratelimit limits the rate of requests with token buckets, and budgets them against daily or monthly quotas
+// that persist across restarts.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket allowing a number of requests per period, with bursts of up to its capacity
+type Bucket struct {
+	mu       sync.Mutex
+	rate     float64 // tokens added per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewBucket creates a full bucket that allows the given number of requests per period, in bursts of up to burst
+// requests (or requests, if burst is not positive)
+func NewBucket(requests int, per time.Duration, burst int) *Bucket {
+	if burst <= 0 {
+		burst = requests
+	}
+	return &Bucket{rate: float64(requests) / per.Seconds(), capacity: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait takes a token from the bucket, waiting until one is available or the given context is cancelled
+func (b *Bucket) Wait(ctx context.Context) error {
+	delay := b.reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token, returning how long to wait until it is actually available
+func (b *Bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
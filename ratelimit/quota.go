@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Period is the calendar period a quota applies to, in UTC
+type Period string
+
+// Periods of quotas
+const (
+	Daily   Period = "daily"
+	Monthly Period = "monthly"
+)
+
+// bounds returns the start and end of the period containing t
+func (p Period) bounds(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if p == Monthly {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Quota is a maximum number of requests per period, counted under a name shared by every request it applies to
+type Quota struct {
+	Name   string
+	Period Period
+	Limit  int
+}
+
+func (q Quota) id() string {
+	return q.Name + "/" + string(q.Period)
+}
+
+// WarnFraction is the fraction of a quota after which a warning is reported
+const WarnFraction = 0.8
+
+// Usage is the number of requests counted against a quota in its current period
+type Usage struct {
+	Quota
+	Used int
+}
+
+// Tracker counts requests against quotas, pacing them so that a quota lasts until the end of its period. Counts are
+// persisted to a file, if one is given, whenever Save is called.
+type Tracker struct {
+	mu     sync.Mutex
+	path   string
+	counts map[string]*count
+	dirty  bool
+}
+
+type count struct {
+	Start time.Time `json:"start"`
+	Used  int       `json:"used"`
+	// warned and paced record the warnings already reported in the current period
+	warned bool
+	paced  bool
+}
+
+// NewTracker creates a tracker that persists its counts to the given file, loading the counts already in it. If path
+// is empty, counts are kept in memory only.
+func NewTracker(path string) (*Tracker, error) {
+	t := &Tracker{path: path, counts: make(map[string]*count)}
+	if path == "" {
+		return t, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read quota file: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.counts); err != nil {
+		return nil, fmt.Errorf("Could not parse quota file %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Reserve counts a request against every given quota if all of them allow it at the given time, returning whether
+// they did along with warnings to report. A quota allows a request if it isn't used up and, so that it lasts until
+// the end of its period, if no more than its share of the period so far has been used, plus a small allowance for
+// bursts; requests beyond that are refused, which spreads them out as if their interval was widened.
+func (t *Tracker) Reserve(now time.Time, quotas ...Quota) (bool, []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var warnings []string
+	allowed := true
+	for _, q := range quotas {
+		c := t.count(q, now)
+		if float64(c.Used+1) > allowance(q, now) {
+			allowed = false
+			if !c.paced {
+				c.paced = true
+				warnings = append(warnings, fmt.Sprintf("%s quota %s is nearly used up (%d of %d), pacing requests to last until the end of the period", q.Period, q.Name, c.Used, q.Limit))
+			}
+		}
+	}
+	if !allowed {
+		return false, warnings
+	}
+	for _, q := range quotas {
+		c := t.count(q, now)
+		c.Used++
+		if !c.warned && float64(c.Used) >= WarnFraction*float64(q.Limit) {
+			c.warned = true
+			warnings = append(warnings, fmt.Sprintf("%s quota %s is %.0f%% used (%d of %d)", q.Period, q.Name, 100*float64(c.Used)/float64(q.Limit), c.Used, q.Limit))
+		}
+	}
+	t.dirty = true
+	return true, warnings
+}
+
+// allowance returns how many requests a quota allows by the given time
+func allowance(q Quota, now time.Time) float64 {
+	start, end := q.Period.bounds(now)
+	elapsed := now.Sub(start).Seconds() / end.Sub(start).Seconds()
+	burst := float64(q.Limit) / 100
+	if burst < 1 {
+		burst = 1
+	}
+	allowed := float64(q.Limit)*elapsed + burst
+	if allowed > float64(q.Limit) {
+		allowed = float64(q.Limit)
+	}
+	return allowed
+}
+
+// count returns the count of a quota in the period containing the given time; t.mu must be held
+func (t *Tracker) count(q Quota, now time.Time) *count {
+	start, _ := q.Period.bounds(now)
+	c, ok := t.counts[q.id()]
+	if !ok || !c.Start.Equal(start) {
+		c = &count{Start: start}
+		t.counts[q.id()] = c
+	}
+	return c
+}
+
+// Usage returns the number of requests counted against each given quota in its current period
+func (t *Tracker) Usage(now time.Time, quotas ...Quota) []Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := make([]Usage, 0, len(quotas))
+	for _, q := range quotas {
+		usage = append(usage, Usage{Quota: q, Used: t.count(q, now).Used})
+	}
+	return usage
+}
+
+// Save writes the counts to the tracker's file if they changed since they were last saved
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.path == "" || !t.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(t.counts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(t.path), filepath.Base(t.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("Could not save quota file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Could not save quota file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Could not save quota file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		return fmt.Errorf("Could not save quota file: %w", err)
+	}
+	t.dirty = false
+	return nil
+}
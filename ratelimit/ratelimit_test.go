@@ -0,0 +1,147 @@
+package ratelimit
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketReserve(t *testing.T) {
+	b := NewBucket(60, time.Minute, 2)
+	now := b.last
+	if b.reserve(now) != 0 || b.reserve(now) != 0 {
+		t.Errorf("Expected a burst of 2 requests to be allowed immediately")
+	}
+	if delay := b.reserve(now); delay != time.Second {
+		t.Errorf("Expected the third request to wait a second, got %v", delay)
+	}
+	if delay := b.reserve(now.Add(10 * time.Second)); delay != 0 {
+		t.Errorf("Expected the bucket to refill, got a delay of %v", delay)
+	}
+}
+
+func TestBucketWaitReturnsTokenWhenCancelled(t *testing.T) {
+	b := NewBucket(1, time.Hour, 1)
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err == nil {
+		t.Errorf("Expected the second request to wait for the hour")
+	}
+	if b.tokens < -0.01 || b.tokens > 0.01 {
+		t.Errorf("Expected the reserved token to be returned, got %v tokens", b.tokens)
+	}
+}
+
+func TestTrackerPacesQuota(t *testing.T) {
+	tracker, err := NewTracker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	quota := Quota{Name: "host api.example.com", Period: Daily, Limit: 240}
+	midnight := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	// the allowance at midnight is the burst of 1% of the quota
+	allowed := 0
+	var warnings []string
+	for i := 0; i < 5; i++ {
+		ok, w := tracker.Reserve(midnight, quota)
+		warnings = append(warnings, w...)
+		if ok {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Expected 2 requests allowed at midnight, got %d", allowed)
+	}
+
+	// by noon, half the quota is available
+	noon := midnight.Add(12 * time.Hour)
+	for i := 0; i < 200; i++ {
+		ok, w := tracker.Reserve(noon, quota)
+		warnings = append(warnings, w...)
+		if ok {
+			allowed++
+		}
+	}
+	if allowed != 122 {
+		t.Errorf("Expected 122 requests allowed by noon, got %d", allowed)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "pacing") {
+		t.Errorf("Expected a single pacing warning, got %v", warnings)
+	}
+
+	// the warning threshold is reported once, and the whole quota is available by the end of the day
+	warnings = nil
+	endOfDay := midnight.Add(24*time.Hour - time.Minute)
+	for i := 0; i < 240; i++ {
+		_, w := tracker.Reserve(endOfDay, quota)
+		warnings = append(warnings, w...)
+	}
+	if usage := tracker.Usage(endOfDay, quota); usage[0].Used != 240 {
+		t.Errorf("Expected the quota to be used up, got %+v", usage)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "80% used") {
+		t.Errorf("Expected a single usage warning, got %v", warnings)
+	}
+
+	// a new day starts a new count
+	if ok, _ := tracker.Reserve(midnight.AddDate(0, 0, 1), quota); !ok {
+		t.Errorf("Expected the quota to be reset the next day")
+	}
+}
+
+func TestTrackerRequiresEveryQuota(t *testing.T) {
+	tracker, _ := NewTracker("")
+	daily := Quota{Name: "group paid", Period: Daily, Limit: 1000}
+	monthly := Quota{Name: "group paid", Period: Monthly, Limit: 1}
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+	if ok, _ := tracker.Reserve(now, daily, monthly); !ok {
+		t.Fatalf("Expected the first request to be allowed")
+	}
+	if ok, _ := tracker.Reserve(now, daily, monthly); ok {
+		t.Errorf("Expected the monthly quota to refuse the second request")
+	}
+	if usage := tracker.Usage(now, daily); usage[0].Used != 1 {
+		t.Errorf("Expected refused requests not to be counted, got %+v", usage)
+	}
+}
+
+func TestTrackerPersistsCounts(t *testing.T) {
+	path := filepath.Join(tempDir(t), "quota.json")
+	quota := Quota{Name: "host api.example.com", Period: Monthly, Limit: 1000}
+	now := time.Now()
+	tracker, err := NewTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.Reserve(now, quota)
+	tracker.Reserve(now, quota)
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("Could not save: %v", err)
+	}
+
+	reloaded, err := NewTracker(path)
+	if err != nil {
+		t.Fatalf("Could not load: %v", err)
+	}
+	if usage := reloaded.Usage(now, quota); usage[0].Used != 2 {
+		t.Errorf("Expected counts to persist, got %+v", usage)
+	}
+}
+
+// tempDir creates a temporary directory that is removed when the test ends
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oracle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
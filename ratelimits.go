@@ -0,0 +1,126 @@
+package framework
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/ratelimit"
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+)
+
+// errQuotaExhausted is returned for requests that are skipped to make a quota last until the end of its period
+var errQuotaExhausted = errors.New("Request skipped to stay within quota")
+
+// rateLimits are the compiled models.Config.RateLimits
+type rateLimits struct {
+	limits  []*rateLimit
+	tracker *ratelimit.Tracker
+}
+
+type rateLimit struct {
+	models.RateLimit
+	name   string // "host api.example.com" or "group name"
+	bucket *ratelimit.Bucket
+	quotas []ratelimit.Quota
+}
+
+func newRateLimits(config *models.Config) (*rateLimits, error) {
+	tracker, err := ratelimit.NewTracker(config.QuotaFile)
+	if err != nil {
+		return nil, err
+	}
+	r := &rateLimits{tracker: tracker}
+	for _, limit := range config.RateLimits {
+		if err := validateRateLimit(limit); err != nil {
+			return nil, err
+		}
+		l := &rateLimit{RateLimit: limit, name: "host " + limit.Host}
+		if limit.Group != "" {
+			l.name = "group " + limit.Group
+		}
+		if limit.Requests > 0 {
+			per := limit.Per
+			if per == 0 {
+				per = time.Minute
+			}
+			l.bucket = ratelimit.NewBucket(limit.Requests, per, limit.Burst)
+		}
+		if limit.DailyQuota > 0 {
+			l.quotas = append(l.quotas, ratelimit.Quota{Name: l.name, Period: ratelimit.Daily, Limit: limit.DailyQuota})
+		}
+		if limit.MonthlyQuota > 0 {
+			l.quotas = append(l.quotas, ratelimit.Quota{Name: l.name, Period: ratelimit.Monthly, Limit: limit.MonthlyQuota})
+		}
+		r.limits = append(r.limits, l)
+	}
+	return r, nil
+}
+
+func validateRateLimit(limit models.RateLimit) error {
+	switch {
+	case (limit.Host == "") == (limit.Group == ""):
+		return fmt.Errorf("A rate limit must have either a host or a group")
+	case limit.Requests < 0 || limit.Per < 0 || limit.Burst < 0 || limit.DailyQuota < 0 || limit.MonthlyQuota < 0:
+		return fmt.Errorf("Rate limit of %s%s has a negative setting", limit.Host, limit.Group)
+	case limit.Requests == 0 && limit.DailyQuota == 0 && limit.MonthlyQuota == 0:
+		return fmt.Errorf("Rate limit of %s%s needs requests or a quota", limit.Host, limit.Group)
+	}
+	return nil
+}
+
+// matching returns the rate limits that apply to the given endpoint
+func (r *rateLimits) matching(e models.Endpoint) []*rateLimit {
+	var host string
+	if u, err := url.Parse(e.Endpoint); err == nil {
+		host = u.Hostname()
+	}
+	var limits []*rateLimit
+	for _, l := range r.limits {
+		if (l.Host != "" && strings.EqualFold(l.Host, host)) || (l.Group != "" && l.Group == e.Group) {
+			limits = append(limits, l)
+		}
+	}
+	return limits
+}
+
+// waitForRateLimits waits until a request to the given endpoint is within its rate limits, counting it against its
+// quotas; it returns an error wrapping errQuotaExhausted if a quota doesn't allow the request now
+func (o *Oracle) waitForRateLimits(ctx context.Context, e models.Endpoint) error {
+	limits := o.rateLimits.matching(e)
+	var quotas []ratelimit.Quota
+	for _, l := range limits {
+		quotas = append(quotas, l.quotas...)
+	}
+	if len(quotas) > 0 {
+		now := time.Now()
+		allowed, warnings := o.rateLimits.tracker.Reserve(now, quotas...)
+		for _, warning := range warnings {
+			o.log.Warnf("%s", warning)
+		}
+		o.metrics.observeQuotas(o.rateLimits.tracker.Usage(now, quotas...))
+		if !allowed {
+			return &utils.APIError{Class: utils.ErrorClassQuota, Err: fmt.Errorf("%w of %s", errQuotaExhausted, e.Endpoint)}
+		}
+	}
+	for _, l := range limits {
+		if l.bucket == nil {
+			continue
+		}
+		if err := l.bucket.Wait(ctx); err != nil {
+			return &utils.APIError{Class: utils.ErrorClassCanceled, Err: err}
+		}
+	}
+	return nil
+}
+
+// saveQuotas persists the number of requests counted against quotas
+func (o *Oracle) saveQuotas() {
+	if err := o.rateLimits.tracker.Save(); err != nil {
+		o.log.WithError(err).Errorln("Could not save quota usage")
+	}
+}
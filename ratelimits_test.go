@@ -0,0 +1,65 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/ratelimit"
+)
+
+func TestQuotaSkipsSourceAndPersists(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte(`{"v": 10}`))
+	}))
+	defer server.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{{Key: "a", Endpoints: []models.Endpoint{
+		{Endpoint: server.URL + "/paid", Group: "paid", JSONPaths: map[string]string{"v": "$.v"}},
+		{Endpoint: server.URL + "/free", JSONPaths: map[string]string{"v": "$.v"}},
+	}}}}
+	quotaFile := filepath.Join(tempDir(t), "quota.json")
+	config := &models.Config{CanisterName: ".", QuotaFile: quotaFile, RateLimits: []models.RateLimit{{Group: "paid", MonthlyQuota: 1}}}
+	o := newTestOracle(t, config, engine)
+
+	o.RunOnce(context.Background())
+	o.RunOnce(context.Background())
+
+	if requests["/paid"] != 1 || requests["/free"] != 2 {
+		t.Errorf("Expected the paid source to be skipped once its quota is used, got %v", requests)
+	}
+	if status := o.ServiceStatus().Keys; len(status) != 1 || !status[0].Success {
+		t.Errorf("Expected the key to be updated from the remaining source, got %+v", status)
+	}
+	tracker, err := ratelimit.NewTracker(quotaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage := tracker.Usage(time.Now(), ratelimit.Quota{Name: "group paid", Period: ratelimit.Monthly, Limit: 1}); usage[0].Used != 1 {
+		t.Errorf("Expected the quota usage to be saved, got %+v", usage)
+	}
+}
+
+func TestNewOracleRejectsInvalidRateLimits(t *testing.T) {
+	for _, limit := range []models.RateLimit{
+		{Requests: 10},
+		{Host: "a.example", Group: "a", Requests: 10},
+		{Host: "a.example"},
+		{Host: "a.example", Requests: -1},
+	} {
+		if _, err := NewOracle(&models.Config{CanisterName: "test", UpdateInterval: time.Minute, RateLimits: []models.RateLimit{limit}}, &models.Engine{}); err == nil {
+			t.Errorf("Expected an error for %+v", limit)
+		}
+	}
+}
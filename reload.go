@@ -0,0 +1,210 @@
+package framework
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// reloadableSettings are the settings of models.Config that Reload applies to a running oracle
+type reloadableSettings struct {
+	UpdateInterval      time.Duration
+	ShutdownGracePeriod time.Duration
+}
+
+// settings returns the current reloadable settings
+func (o *Oracle) settings() reloadableSettings {
+	o.engineMu.RLock()
+	defer o.engineMu.RUnlock()
+	return reloadableSettings{UpdateInterval: o.config.UpdateInterval, ShutdownGracePeriod: o.config.ShutdownGracePeriod}
+}
+
+// Reload replaces the keys of the oracle with those of the given engine, and its update interval, shutdown grace
+// period and transport settings with those of the given configuration. Certificate files are read again, so rotated
+// certificates take effect without a restart. The new configuration is validated fully first; if it is invalid, an
+// error is returned and the current configuration is kept. The new keys apply from the next round, and a round in
+// progress is not affected. Paused keys stay paused. Other settings, such as the canister name or network, require a
+// restart; changes to them are logged and ignored.
+func (o *Oracle) Reload(config *models.Config, engine *models.Engine) error {
+	plan, err := o.validateReload(config, engine)
+	if err != nil {
+		o.log.WithError(err).Errorln("Rejected configuration reload, keeping the current configuration")
+		return err
+	}
+	clients, err := newClients(config, engine)
+	if err != nil {
+		o.log.WithError(err).Errorln("Rejected configuration reload, keeping the current configuration")
+		return err
+	}
+
+	o.engineMu.Lock()
+	changes := diffPlans(o.plan, plan)
+	if o.config.UpdateInterval != config.UpdateInterval {
+		changes = append(changes, fmt.Sprintf("update interval changed from %v to %v", o.config.UpdateInterval, config.UpdateInterval))
+	}
+	if o.config.ShutdownGracePeriod != config.ShutdownGracePeriod {
+		changes = append(changes, fmt.Sprintf("shutdown grace period changed from %v to %v", o.config.ShutdownGracePeriod, config.ShutdownGracePeriod))
+	}
+	if !reflect.DeepEqual(o.config.Transport, config.Transport) {
+		changes = append(changes, "transport settings changed")
+	}
+	ignored := restartRequiredChanges(o.config, config)
+	for _, meta := range o.plan.metadata {
+		if _, ok := plan.find(meta.Key); !ok {
+			o.forgetKey(meta.Key)
+		}
+	}
+	o.engine, o.plan, o.clients = engine, plan, clients
+	o.config.UpdateInterval, o.config.ShutdownGracePeriod = config.UpdateInterval, config.ShutdownGracePeriod
+	o.config.Transport = config.Transport
+	o.engineMu.Unlock()
+
+	o.reschedule()
+	if len(changes) == 0 {
+		o.log.Infof("Reloaded configuration, nothing changed")
+	}
+	for _, change := range changes {
+		o.log.Infof("Reloaded configuration: %s", change)
+	}
+	if len(ignored) > 0 {
+		o.log.Warnf("Reloaded configuration changes %s, which only take effect after a restart", strings.Join(ignored, ", "))
+	}
+	return nil
+}
+
+// validateReload checks that the given configuration could be used to create a new oracle, returning the round plan
+// of its keys
+func (o *Oracle) validateReload(config *models.Config, engine *models.Engine) (*roundPlan, error) {
+	if config.UpdateInterval <= 0 {
+		return nil, fmt.Errorf("Invalid update interval %v", config.UpdateInterval)
+	}
+	plan, err := newRoundPlan(engine)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := renderCanister(config); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// diffPlans describes the keys that were added, removed or changed between two round plans
+func diffPlans(old *roundPlan, new *roundPlan) []string {
+	var changes []string
+	for _, meta := range new.metadata {
+		oldMeta, ok := old.find(meta.Key)
+		if !ok {
+			changes = append(changes, fmt.Sprintf("added key %s", meta.Key))
+			continue
+		}
+		fields := metadataChanges(reflect.ValueOf(oldMeta), reflect.ValueOf(meta), "")
+		if len(fields) > 0 {
+			changes = append(changes, fmt.Sprintf("changed %s of key %s", strings.Join(fields, ", "), meta.Key))
+		}
+	}
+	for _, meta := range old.metadata {
+		if _, ok := new.find(meta.Key); !ok {
+			changes = append(changes, fmt.Sprintf("removed key %s", meta.Key))
+		}
+	}
+	return changes
+}
+
+// metadataChanges returns the names of the fields that differ between two values of the same struct type, such as the
+// metadata of a key, naming the fields of nested endpoints after the endpoint they are in (e.g. "endpoints[0].headers")
+func metadataChanges(old reflect.Value, new reflect.Value, prefix string) []string {
+	var fields []string
+	for i := 0; i < old.NumField(); i++ {
+		name := prefix + snakeCase(old.Type().Field(i).Name)
+		oldField, newField := old.Field(i), new.Field(i)
+		if sameValue(oldField, newField) {
+			continue
+		}
+		if oldField.Kind() == reflect.Slice && oldField.Len() == newField.Len() && oldField.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < oldField.Len(); j++ {
+				fields = append(fields, metadataChanges(oldField.Index(j), newField.Index(j), fmt.Sprintf("%s[%d].", name, j))...)
+			}
+			continue
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// sameValue is like reflect.DeepEqual, except that functions are the same if they are the same function, so that
+// summarizers and normalizers that didn't change aren't reported as changed
+func sameValue(a reflect.Value, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Func:
+		return a.Pointer() == b.Pointer()
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return a.Elem().Type() == b.Elem().Type() && sameValue(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !sameValue(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !sameValue(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for _, key := range a.MapKeys() {
+			value := b.MapIndex(key)
+			if !value.IsValid() || !sameValue(a.MapIndex(key), value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(a.Interface(), b.Interface())
+	}
+}
+
+// snakeCase converts the name of a Go field to the style of configuration file keys, e.g. "JSONPaths" to "json_paths"
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// restartRequiredChanges returns the names of the settings that differ between two configurations and can't be
+// reloaded
+func restartRequiredChanges(old *models.Config, new *models.Config) []string {
+	var fields []string
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*new)
+	for i := 0; i < oldValue.NumField(); i++ {
+		name := oldValue.Type().Field(i).Name
+		if name == "UpdateInterval" || name == "ShutdownGracePeriod" || name == "Transport" {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
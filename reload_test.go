@@ -0,0 +1,150 @@
+package framework
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/summary"
+)
+
+func TestReloadSwapsKeysAndLogsChanges(t *testing.T) {
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "a", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/a", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "b", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/b", JSONPaths: map[string]string{"v": "$.v"}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: "test", UpdateInterval: time.Minute}, engine)
+	var logs bytes.Buffer
+	o.log.Out = &logs
+	o.PauseKey("a")
+
+	reloaded := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "a", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/a", JSONPaths: map[string]string{"v": "$.value"}}}},
+		{Key: "c", Derived: &models.Derivation{Expressions: map[string]string{"v": "a.v * 2"}}},
+	}}
+	if err := o.Reload(&models.Config{CanisterName: "other", UpdateInterval: time.Second}, reloaded); err != nil {
+		t.Fatalf("Could not reload: %v", err)
+	}
+
+	keys := o.Keys()
+	if len(keys) != 2 || keys[0].Key != "a" || !keys[0].Paused || keys[0].Endpoints[0].JSONPaths["v"] != "$.value" || keys[1].Key != "c" {
+		t.Errorf("Incorrect keys after reload %+v", keys)
+	}
+	if o.settings().UpdateInterval != time.Second {
+		t.Errorf("Expected the update interval to be reloaded")
+	}
+	for _, expected := range []string{"changed endpoints[0].json_paths of key a", "added key c", "removed key b", "update interval changed from 1m0s to 1s", "CanisterName, which only take effect after a restart"} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected logs to contain %q, got %s", expected, logs.String())
+		}
+	}
+}
+
+func TestDiffPlansReportsEveryChangedSetting(t *testing.T) {
+	normalize := func(map[string]interface{}) (map[string]float64, error) { return nil, nil }
+	endpoint := models.Endpoint{Endpoint: "https://example.com/a", JSONPaths: map[string]string{"v": "$.v"}, NormalizeFunc: normalize}
+	old, err := newRoundPlan(&models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "a", SummaryFunc: summary.Mean, Endpoints: []models.Endpoint{endpoint}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := diffPlans(old, old); len(changes) != 0 {
+		t.Errorf("Expected no changes, got %v", changes)
+	}
+
+	changed := endpoint
+	changed.Method, changed.Headers, changed.Body, changed.Group = "POST", map[string]string{"X-Key": "secret"}, "{}", "upstream"
+	changed.Transport = &models.Transport{MinTLSVersion: "1.3"}
+	changed.NormalizeFunc = nil
+	new, err := newRoundPlan(&models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "a", SummaryFunc: summary.Median, Endpoints: []models.Endpoint{changed}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "changed summary_func, endpoints[0].method, endpoints[0].headers, endpoints[0].body, endpoints[0].transport, endpoints[0].group, endpoints[0].normalize_func of key a"
+	if changes := diffPlans(old, new); len(changes) != 1 || changes[0] != expected {
+		t.Errorf("Expected %q, got %v", expected, changes)
+	}
+}
+
+func TestRemovedKeysAreForgotten(t *testing.T) {
+	metadata := []models.MappingMetadata{
+		{Key: "a", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/a", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "b", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/b", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "c", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/c", JSONPaths: map[string]string{"v": "$.v"}}}},
+	}
+	o := newTestOracle(t, &models.Config{CanisterName: "test"}, &models.Engine{Metadata: metadata})
+	for _, key := range []string{"a", "b", "c"} {
+		o.history.record(key, "v", models.Sample{Time: time.Now(), Value: 1}, 0)
+		o.metrics.observePublished(key, map[string]float64{"v": 1}, time.Now())
+	}
+
+	if err := o.RemoveKey("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Reload(&models.Config{CanisterName: "test", UpdateInterval: time.Minute}, &models.Engine{Metadata: metadata[2:]}); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]int{"a": 0, "b": 0, "c": 1} {
+		if samples := o.history.get(key, "v"); len(samples) != expected {
+			t.Errorf("Expected %d samples for key %s, got %v", expected, key, samples)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	o.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, series := range []string{`oracle_published_value{key="%s",field="v"}`, `oracle_published_timestamp_seconds{key="%s",field="v"}`, `oracle_staleness_seconds{key="%s"}`} {
+		for key, expected := range map[string]bool{"a": false, "b": false, "c": true} {
+			if name := fmt.Sprintf(series, key); strings.Contains(body, name) != expected {
+				t.Errorf("Expected %s to be present %v, got:\n%s", name, expected, body)
+			}
+		}
+	}
+}
+
+func TestReloadRejectsInvalidConfiguration(t *testing.T) {
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "a", Endpoints: []models.Endpoint{{Endpoint: "https://example.com/a", JSONPaths: map[string]string{"v": "$.v"}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: "test", UpdateInterval: time.Minute}, engine)
+
+	cyclic := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "x", Derived: &models.Derivation{Expressions: map[string]string{"v": "y.v"}}},
+		{Key: "y", Derived: &models.Derivation{Expressions: map[string]string{"v": "x.v"}}},
+	}}
+	if err := o.Reload(&models.Config{CanisterName: "test", UpdateInterval: time.Second}, cyclic); err == nil {
+		t.Errorf("Expected cyclic keys to be rejected")
+	}
+	if err := o.Reload(&models.Config{CanisterName: "test"}, engine); err == nil {
+		t.Errorf("Expected a missing update interval to be rejected")
+	}
+	if keys := o.Keys(); len(keys) != 1 || keys[0].Key != "a" || o.settings().UpdateInterval != time.Minute {
+		t.Errorf("Expected the current configuration to be kept, got %+v", keys)
+	}
+}
+
+func TestRunReschedulesAfterReload(t *testing.T) {
+	o := newTestOracle(t, &models.Config{CanisterName: "test", UpdateInterval: time.Hour}, &models.Engine{})
+	result := make(chan error)
+	go func() { result <- o.Run(context.Background()) }()
+	defer func() {
+		o.Stop()
+		<-result
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	firstRound := *o.ServiceStatus().LastRoundStart
+	o.Reload(&models.Config{CanisterName: "test", UpdateInterval: 10 * time.Millisecond}, &models.Engine{})
+	time.Sleep(100 * time.Millisecond)
+	if status := o.ServiceStatus(); !status.LastRoundStart.After(firstRound) {
+		t.Errorf("Expected a round to run at the reloaded interval")
+	}
+}
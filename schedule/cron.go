@@ -0,0 +1,174 @@
+// Package schedule parses cron expressions and computes when they next fire.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cron is a parsed cron expression
+type Cron struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64 // bit sets of the allowed values of each field
+	// restrictedDays records whether day-of-month and day-of-week were both restricted, in which case a day matches if
+	// either of them matches, as in Vixie cron; like there, a field starting with "*" (such as "*/2") is not restricted
+	restrictedDays bool
+	location       *time.Location
+}
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	{"day of week", 0, 7, dayNames}, // 7 is also Sunday
+}
+
+// ParseCron parses a standard five-field cron expression ("minute hour day-of-month month day-of-week"), evaluated in
+// the given location (UTC if nil). Fields may be "*", values, ranges ("1-5"), steps ("*/15", "0-30/10"), lists of
+// these ("1,15"), or month and day names ("JAN", "MON"). The macros @yearly, @monthly, @weekly, @daily and @hourly are
+// also accepted.
+func ParseCron(expression string, location *time.Location) (*Cron, error) {
+	if location == nil {
+		location = time.UTC
+	}
+	spec := strings.TrimSpace(expression)
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("Invalid cron expression %q: expected 5 fields, got %d", expression, len(parts))
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %q: %w", expression, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1 // Sunday
+	}
+	return &Cron{
+		minute:         sets[0],
+		hour:           sets[1],
+		dayOfMonth:     sets[2],
+		month:          sets[3],
+		dayOfWeek:      sets[4],
+		restrictedDays: !strings.HasPrefix(parts[2], "*") && !strings.HasPrefix(parts[4], "*"),
+		location:       location,
+	}, nil
+}
+
+func parseField(part string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(part, ",") {
+		rangePart, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field %q", f.name, item)
+			}
+			rangePart = item[:i]
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// "10/5" means every 5 starting at 10
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid range in %s field %q", f.name, item)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, expected a value from %d to %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// maxSearchYears bounds the search for the next time, for expressions such as "0 0 30 2 *" that never fire
+const maxSearchYears = 5
+
+// Next returns the first time after the given time that the expression fires, or the zero time if it never does
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.In(c.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+		case !has(c.hour, t.Hour()):
+			// not t.Truncate(time.Hour), which truncates in UTC and so misses the hour in zones with half-hour offsets
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	dayOfMonth, dayOfWeek := has(c.dayOfMonth, t.Day()), has(c.dayOfWeek, int(t.Weekday()))
+	if c.restrictedDays {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<uint(value)) != 0
+}
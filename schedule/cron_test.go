@@ -0,0 +1,130 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestCronNext(t *testing.T) {
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		t.Skipf("Time zone database unavailable: %v", err)
+	}
+	after := time.Date(2024, time.January, 31, 23, 59, 30, 0, time.UTC) // a Wednesday
+	cases := []struct {
+		expression string
+		location   *time.Location
+		expected   time.Time
+	}{
+		{"* * * * *", nil, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"5 0 * * *", nil, time.Date(2024, time.February, 1, 0, 5, 0, 0, time.UTC)},
+		{"*/15 9-17 * * MON-FRI", nil, time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 12 29 feb *", nil, time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1,15 * 0", nil, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},  // day of month or Sunday
+		{"0 0 */2 * MON", nil, time.Date(2024, time.February, 5, 0, 0, 0, 0, time.UTC)}, // odd day of month and Monday
+		{"0 0 * * 7", nil, time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{"30/10 * * * *", nil, time.Date(2024, time.February, 1, 0, 30, 0, 0, time.UTC)},
+		{"@monthly", nil, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 8 * * *", zurich, time.Date(2024, time.February, 1, 7, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expression, c.location)
+		if err != nil {
+			t.Errorf("Could not parse %q: %v", c.expression, err)
+			continue
+		}
+		if next := cron.Next(after); !next.Equal(c.expected) {
+			t.Errorf("Incorrect next time for %q, expected %v, got %v", c.expression, c.expected, next)
+		}
+	}
+}
+
+func TestCronNextInLocalTime(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skipf("Time zone database unavailable: %v", err)
+	}
+	zurich, _ := time.LoadLocation("Europe/Zurich")
+	cases := []struct {
+		expression string
+		location   *time.Location
+		after      time.Time
+		expected   time.Time
+	}{
+		// UTC+5:30, where the hour starts at :30 UTC
+		{"5 11 * * *", kolkata, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, time.January, 1, 5, 35, 0, 0, time.UTC)},
+		{"0 * * * *", kolkata, time.Date(2024, time.January, 1, 0, 10, 0, 0, time.UTC), time.Date(2024, time.January, 1, 0, 30, 0, 0, time.UTC)},
+		// clocks go forward from 02:00 to 03:00 on March 31, 2024
+		{"0 3 * * *", zurich, time.Date(2024, time.March, 30, 23, 30, 0, 0, time.UTC), time.Date(2024, time.March, 31, 1, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", zurich, time.Date(2024, time.March, 30, 23, 30, 0, 0, time.UTC), time.Date(2024, time.April, 1, 0, 30, 0, 0, time.UTC)},
+		// clocks go back from 03:00 to 02:00 on October 27, 2024; the repeated hour is only entered once
+		{"30 2 * * *", zurich, time.Date(2024, time.October, 26, 22, 0, 0, 0, time.UTC), time.Date(2024, time.October, 27, 1, 30, 0, 0, time.UTC)},
+		{"30 2 * * *", zurich, time.Date(2024, time.October, 27, 1, 30, 0, 0, time.UTC), time.Date(2024, time.October, 28, 1, 30, 0, 0, time.UTC)},
+		{"0 4 * * *", zurich, time.Date(2024, time.October, 26, 22, 0, 0, 0, time.UTC), time.Date(2024, time.October, 27, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expression, c.location)
+		if err != nil {
+			t.Errorf("Could not parse %q: %v", c.expression, err)
+			continue
+		}
+		if next := cron.Next(c.after); !next.Equal(c.expected) {
+			t.Errorf("Incorrect next time for %q in %s after %v, expected %v, got %v", c.expression, c.location, c.after, c.expected, next.UTC())
+		}
+	}
+	if _, err := Compile(models.Schedule{Cron: "5 11 * * *", Timezone: "Asia/Kolkata"}); err != nil {
+		t.Errorf("Expected a schedule in a half-hour offset zone to be valid, got %v", err)
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expression, nil); err == nil {
+			t.Errorf("Expected an error for %q", expression)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	invalid := []models.Schedule{
+		{Interval: -time.Second},
+		{Interval: time.Minute, Cron: "* * * * *"},
+		{Timezone: "UTC"},
+		{Cron: "0 0 30 2 *"},
+		{Cron: "* * * * *", Jitter: -time.Second},
+	}
+	for _, s := range invalid {
+		if _, err := Compile(s); err == nil {
+			t.Errorf("Expected an error for %+v", s)
+		}
+	}
+}
+
+func TestSpecNext(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 12, 0, 30, 0, time.UTC)
+	interval, err := Compile(models.Schedule{Interval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := interval.Next(time.Time{}, now, time.Hour); !next.Equal(now) {
+		t.Errorf("Expected the first update to be due immediately, got %v", next)
+	}
+	if next := interval.Next(now.Add(-10*time.Second), now, time.Hour); !next.Equal(now.Add(50 * time.Second)) {
+		t.Errorf("Expected the next update one interval after the previous one, got %v", next)
+	}
+	if next := interval.Next(now.Add(-time.Hour), now, time.Hour); !next.Equal(now) {
+		t.Errorf("Expected an overdue update to be due immediately, got %v", next)
+	}
+
+	shared, _ := Compile(models.Schedule{})
+	if next := shared.Next(now, now, time.Hour); !next.Equal(now.Add(time.Hour)) {
+		t.Errorf("Expected the default interval to be used, got %v", next)
+	}
+
+	cron, _ := Compile(models.Schedule{Cron: "5 0 * * *"})
+	if next := cron.Next(time.Time{}, now, time.Hour); !next.Equal(time.Date(2024, time.January, 2, 0, 5, 0, 0, time.UTC)) {
+		t.Errorf("Expected the first cron update at the next time it fires, got %v", next)
+	}
+}
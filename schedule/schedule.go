@@ -0,0 +1,66 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// Spec is a validated models.Schedule
+type Spec struct {
+	models.Schedule
+	cron *Cron
+}
+
+// Compile validates a schedule, parsing its cron expression and time zone
+func Compile(s models.Schedule) (*Spec, error) {
+	spec := &Spec{Schedule: s}
+	switch {
+	case s.Interval < 0:
+		return nil, fmt.Errorf("Invalid schedule interval %v", s.Interval)
+	case s.Jitter < 0:
+		return nil, fmt.Errorf("Invalid schedule jitter %v", s.Jitter)
+	case s.Interval != 0 && s.Cron != "":
+		return nil, fmt.Errorf("A schedule must have either an interval or a cron expression, not both")
+	case s.Timezone != "" && s.Cron == "":
+		return nil, fmt.Errorf("A schedule timezone requires a cron expression")
+	case s.Cron == "":
+		return spec, nil
+	}
+
+	location := time.UTC
+	if s.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, fmt.Errorf("Invalid schedule timezone %q: %w", s.Timezone, err)
+		}
+	}
+	cron, err := ParseCron(s.Cron, location)
+	if err != nil {
+		return nil, err
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Cron expression %q never fires", s.Cron)
+	}
+	spec.cron = cron
+	return spec, nil
+}
+
+// Next returns when the update following one scheduled for previous is due, before jitter. For a cron schedule, that
+// is the first time it fires after now. Otherwise, it is one interval (Interval, or defaultInterval if that isn't set)
+// after previous, or now if that has already passed or there was no previous update.
+func (s *Spec) Next(previous time.Time, now time.Time, defaultInterval time.Duration) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(now)
+	}
+	interval := s.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	next := previous.Add(interval)
+	if previous.IsZero() || next.Before(now) {
+		return now
+	}
+	return next
+}
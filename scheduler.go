@@ -0,0 +1,114 @@
+package framework
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/schedule"
+)
+
+// scheduler tracks when each key is next due to be updated. Keys without their own schedule share one that follows
+// models.Config.UpdateInterval, which runs a round even if no key uses it.
+type scheduler struct {
+	random  *rand.Rand
+	shared  *scheduleEntry
+	entries map[string]*scheduleEntry // keys with their own schedule
+}
+
+type scheduleEntry struct {
+	spec            *schedule.Spec
+	defaultInterval time.Duration // models.Config.UpdateInterval when the entry was scheduled
+	previous        time.Time     // when the last update was scheduled for, before jitter; zero before the first
+	next            time.Time     // when the next update is scheduled for, before jitter
+	due             time.Time     // next plus jitter
+}
+
+// dueKeys are the keys to update in a round
+type dueKeys struct {
+	shared bool            // keys without their own schedule
+	keys   map[string]bool // keys with their own schedule
+}
+
+func (d *dueKeys) includes(plan *roundPlan, key string) bool {
+	if _, ok := plan.schedules[key]; ok {
+		return d.keys[key]
+	}
+	return d.shared
+}
+
+// reschedule makes Run reschedule the next round after the keys or the update interval changed
+func (o *Oracle) reschedule() {
+	select {
+	case o.rescheduled <- struct{}{}:
+	default:
+	}
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{random: rand.New(rand.NewSource(time.Now().UnixNano())), entries: make(map[string]*scheduleEntry)}
+}
+
+// sync schedules the keys of the given plan, keeping the next update of every key whose schedule is unchanged and
+// rescheduling the others from their previous update
+func (s *scheduler) sync(plan *roundPlan, defaultInterval time.Duration, now time.Time) {
+	s.shared = s.entry(s.shared, &schedule.Spec{}, defaultInterval, now)
+	entries := make(map[string]*scheduleEntry, len(plan.schedules))
+	for key, spec := range plan.schedules {
+		entries[key] = s.entry(s.entries[key], spec, defaultInterval, now)
+	}
+	s.entries = entries
+}
+
+func (s *scheduler) entry(existing *scheduleEntry, spec *schedule.Spec, defaultInterval time.Duration, now time.Time) *scheduleEntry {
+	usesDefault := spec.Interval == 0 && spec.Cron == ""
+	if existing != nil && existing.spec.Schedule == spec.Schedule && (!usesDefault || existing.defaultInterval == defaultInterval) {
+		return existing
+	}
+	e := &scheduleEntry{spec: spec, defaultInterval: defaultInterval}
+	if existing != nil {
+		e.previous = existing.previous
+	}
+	s.schedule(e, now)
+	return e
+}
+
+// schedule sets when the update following the previous one of an entry is due
+func (s *scheduler) schedule(e *scheduleEntry, now time.Time) {
+	e.next = e.spec.Next(e.previous, now, e.defaultInterval)
+	e.due = e.next
+	if e.spec.Jitter > 0 {
+		e.due = e.due.Add(time.Duration(s.random.Int63n(int64(e.spec.Jitter))))
+	}
+}
+
+// nextDue returns the earliest time an update is due
+func (s *scheduler) nextDue() time.Time {
+	next := s.shared.due
+	for _, e := range s.entries {
+		if e.due.Before(next) {
+			next = e.due
+		}
+	}
+	return next
+}
+
+// take returns the keys due by now and schedules their next updates
+func (s *scheduler) take(now time.Time) *dueKeys {
+	due := &dueKeys{shared: s.takeEntry(s.shared, now), keys: make(map[string]bool)}
+	for key, e := range s.entries {
+		if s.takeEntry(e, now) {
+			due.keys[key] = true
+		}
+	}
+	return due
+}
+
+func (s *scheduler) takeEntry(e *scheduleEntry, now time.Time) bool {
+	if e.due.After(now) {
+		return false
+	}
+	// intervals are counted from when updates were scheduled for before jitter, so that jitter doesn't accumulate
+	e.previous = e.next
+	s.schedule(e, now)
+	return true
+}
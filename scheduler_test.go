@@ -0,0 +1,91 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestSchedulerTakesDueKeys(t *testing.T) {
+	plan, err := newRoundPlan(&models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "fx", Schedule: &models.Schedule{Interval: time.Minute, Jitter: 10 * time.Second}, Endpoints: []models.Endpoint{{Endpoint: "http://x"}}},
+		{Key: "weather", Schedule: &models.Schedule{Cron: "5 0 * * *"}, Endpoints: []models.Endpoint{{Endpoint: "http://x"}}},
+		{Key: "other", Endpoints: []models.Endpoint{{Endpoint: "http://x"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, time.January, 1, 23, 58, 0, 0, time.UTC)
+	s := newScheduler()
+	s.sync(plan, time.Hour, start)
+
+	fx := s.entries["fx"]
+	if fx.due.Before(start) || !fx.due.Before(start.Add(10*time.Second)) {
+		t.Errorf("Expected the first update of fx within the jitter of the start, got %v", fx.due)
+	}
+	due := s.take(start.Add(10 * time.Second))
+	if !due.shared || !due.keys["fx"] || due.keys["weather"] {
+		t.Errorf("Incorrect keys due at the start %+v", due)
+	}
+	if !due.includes(plan, "other") || !due.includes(plan, "fx") || due.includes(plan, "weather") {
+		t.Errorf("Incorrect keys included in the round %+v", due)
+	}
+	if next := s.entries["fx"].due; next.Before(start.Add(time.Minute)) || !next.Before(start.Add(time.Minute+10*time.Second)) {
+		t.Errorf("Expected the next update of fx one interval after the first, got %v", next)
+	}
+	if next := s.nextDue(); !next.Equal(s.entries["fx"].due) {
+		t.Errorf("Expected fx to be due next, got %v", next)
+	}
+	if weather := s.entries["weather"].due; !weather.Equal(time.Date(2024, time.January, 2, 0, 5, 0, 0, time.UTC)) {
+		t.Errorf("Incorrect next update of weather %v", weather)
+	}
+
+	// changing the default interval only reschedules keys that use it
+	fxDue := s.entries["fx"].due
+	s.sync(plan, time.Minute, start.Add(20*time.Second))
+	if !s.shared.due.Equal(start.Add(time.Minute)) || !s.entries["fx"].due.Equal(fxDue) {
+		t.Errorf("Incorrect schedule after changing the update interval: shared %v, fx %v", s.shared.due, s.entries["fx"].due)
+	}
+}
+
+func TestRunUpdatesKeysOnTheirOwnSchedule(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		w.Write([]byte(`{"v": 1}`))
+	}))
+	defer server.Close()
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "fast", Schedule: &models.Schedule{Interval: 20 * time.Millisecond}, Endpoints: []models.Endpoint{{Endpoint: server.URL + "/fast", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "slow", Endpoints: []models.Endpoint{{Endpoint: server.URL + "/slow", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "derived", Derived: &models.Derivation{Expressions: map[string]string{"v": "fast.v + slow.v"}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: ".", UpdateInterval: time.Hour}, engine)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if err := o.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/slow"] != 1 || requests["/fast"] < 3 {
+		t.Errorf("Expected the fast key to be updated more often than the slow one, got %v", requests)
+	}
+	for _, status := range o.ServiceStatus().Keys {
+		if !status.Success || (status.Key == "derived" && status.PublishedValues["v"] != 2) {
+			t.Errorf("Incorrect status %+v", status)
+		}
+	}
+}
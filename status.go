@@ -0,0 +1,105 @@
+package framework
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ServiceStatus is the state of the oracle service, as tracked during update rounds
+type ServiceStatus struct {
+	Running bool `json:"running"`
+	// LastRoundStart and LastRoundEnd are the times the last update round started and finished, if any
+	LastRoundStart *time.Time `json:"last_round_start,omitempty"`
+	LastRoundEnd   *time.Time `json:"last_round_end,omitempty"`
+	// NextUpdate is the time the next update round is scheduled for, while the service is running
+	NextUpdate *time.Time  `json:"next_update,omitempty"`
+	Keys       []KeyStatus `json:"keys"`
+}
+
+// KeyStatus is the outcome of the last update of a key
+type KeyStatus struct {
+	Key        string    `json:"key"`
+	LastUpdate time.Time `json:"last_update"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	// PublishedValues and PublishedAt are the last values written to the canister, and when
+	PublishedValues map[string]float64 `json:"published_values,omitempty"`
+	PublishedAt     *time.Time         `json:"published_at,omitempty"`
+}
+
+// statusTracker records the state reported by Oracle.ServiceStatus
+type statusTracker struct {
+	mu     sync.Mutex
+	status ServiceStatus
+	keys   map[string]*KeyStatus
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{keys: make(map[string]*KeyStatus)}
+}
+
+func (t *statusTracker) setRunning(running bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.Running = running
+	if !running {
+		t.status.NextUpdate = nil
+	}
+}
+
+func (t *statusTracker) roundStarted(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastRoundStart = &now
+}
+
+func (t *statusTracker) roundFinished(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.LastRoundEnd = &now
+}
+
+func (t *statusTracker) setNextUpdate(next time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status.NextUpdate = &next
+}
+
+// keyUpdated records the outcome of updating a key; values are only given if they were written to the canister
+func (t *statusTracker) keyUpdated(key string, now time.Time, values map[string]float64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status, ok := t.keys[key]
+	if !ok {
+		status = &KeyStatus{Key: key}
+		t.keys[key] = status
+	}
+	status.LastUpdate, status.Success, status.Error = now, err == nil, ""
+	if err != nil {
+		status.Error = err.Error()
+	}
+	if values != nil {
+		status.PublishedValues, status.PublishedAt = make(map[string]float64, len(values)), &now
+		for field, value := range values {
+			status.PublishedValues[field] = value
+		}
+	}
+}
+
+func (t *statusTracker) get() ServiceStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status := t.status
+	status.Keys = make([]KeyStatus, 0, len(t.keys))
+	for _, key := range t.keys {
+		status.Keys = append(status.Keys, *key)
+	}
+	sort.Slice(status.Keys, func(i, j int) bool { return status.Keys[i].Key < status.Keys[j].Key })
+	return status
+}
+
+// ServiceStatus returns the state of the oracle service and the outcome of the last update of every key
+func (o *Oracle) ServiceStatus() ServiceStatus {
+	return o.status.get()
+}
@@ -0,0 +1,118 @@
+package summary
+
+import (
+	"math"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// MeanDetailed: Returns the mean of the dataset, along with dispersion metadata
+func MeanDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		return meanOfArray(values), values
+	})
+}
+
+// MedianDetailed: Returns the median of the dataset, along with dispersion metadata
+func MedianDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		return medianOfArray(values), values
+	})
+}
+
+// ModeDetailed: Returns the mode of the dataset, along with dispersion metadata
+func ModeDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		return modeOfArray(values), values
+	})
+}
+
+// MaxDetailed: Returns the largest value of the dataset, along with dispersion metadata
+func MaxDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		return maxOfArray(values), values
+	})
+}
+
+// MinDetailed: Returns the smallest value of the dataset, along with dispersion metadata
+func MinDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		return minOfArray(values), values
+	})
+}
+
+// MeanWithoutOutliersDetailed: Returns the mean of the dataset after removing outliers, along with dispersion metadata
+func MeanWithoutOutliersDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		used := RemoveOutlier(values)
+		return meanOfArray(used), used
+	})
+}
+
+// MedianWithoutOutliersDetailed: Returns the median of the dataset after removing outliers, along with dispersion metadata
+func MedianWithoutOutliersDetailed(dataset []map[string]float64) map[string]models.SummaryResult {
+	return summarizeFields(dataset, func(values []float64) (float64, []float64) {
+		used := RemoveOutlier(values)
+		return medianOfArray(used), used
+	})
+}
+
+// Detailed: Wraps a plain summarizer so that it also reports dispersion metadata, treating every value as used
+func Detailed(summaryFunc models.SummaryFunc) models.DetailedSummaryFunc {
+	return func(dataset []map[string]float64) map[string]models.SummaryResult {
+		grouped := groupByKey(dataset)
+		result := make(map[string]models.SummaryResult)
+		for key, value := range summaryFunc(dataset) {
+			result[key] = newResult(value, grouped[key], grouped[key])
+		}
+		return result
+	}
+}
+
+// Values: Returns only the summarized values of the given results
+func Values(results map[string]models.SummaryResult) map[string]float64 {
+	values := make(map[string]float64)
+	for key, result := range results {
+		values[key] = result.Value
+	}
+	return values
+}
+
+// summarizeFields: applies the given summarizer to the values of each field, which returns the summarized value and the values it used
+func summarizeFields(dataset []map[string]float64, summarize func([]float64) (float64, []float64)) map[string]models.SummaryResult {
+	result := make(map[string]models.SummaryResult)
+	for key, values := range groupByKey(dataset) {
+		value, used := summarize(values)
+		result[key] = newResult(value, values, used)
+	}
+	return result
+}
+
+func newResult(value float64, values []float64, used []float64) models.SummaryResult {
+	result := models.SummaryResult{
+		Value:          value,
+		Sources:        len(used),
+		Rejected:       len(values) - len(used),
+		ConfidenceLow:  value,
+		ConfidenceHigh: value,
+	}
+	if len(used) == 0 {
+		return result
+	}
+
+	mean := meanOfArray(used)
+	var squaredDiffSum float64
+	for _, x := range used {
+		squaredDiffSum += (x - mean) * (x - mean)
+	}
+	result.StdDev = math.Sqrt(squaredDiffSum / float64(len(used)))
+	result.Min = minOfArray(used)
+	result.Max = maxOfArray(used)
+
+	// 1.96 standard errors either side of the mean covers 95% of a normal distribution; the interval is centred on the
+	// summarized value, which need not be the mean
+	margin := 1.96 * result.StdDev / math.Sqrt(float64(len(used)))
+	result.ConfidenceLow = value - margin
+	result.ConfidenceHigh = value + margin
+	return result
+}
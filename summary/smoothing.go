@@ -0,0 +1,62 @@
+package summary
+
+import (
+	"math"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// TWAP: Returns a smoothing function computing the time-weighted average of the samples over the given window, where
+// each sample holds until the next one
+func TWAP(window time.Duration) models.SmoothingFunc {
+	return func(samples []models.Sample, now time.Time) float64 {
+		if len(samples) == 0 {
+			return math.NaN()
+		}
+
+		windowStart := now.Add(-window)
+		var weightedSum, totalWeight float64
+		for i, sample := range samples {
+			start, end := sample.Time, now
+			if i+1 < len(samples) {
+				end = samples[i+1].Time
+			}
+			if start.Before(windowStart) {
+				start = windowStart
+			}
+			if !end.After(start) {
+				continue
+			}
+			weight := end.Sub(start).Seconds()
+			weightedSum += sample.Value * weight
+			totalWeight += weight
+		}
+
+		if totalWeight == 0 {
+			return samples[len(samples)-1].Value
+		}
+		return weightedSum / totalWeight
+	}
+}
+
+// EMA: Returns a smoothing function computing the exponential moving average of the samples, where the weight of a
+// sample halves every halfLife. A non-positive halfLife does no smoothing, returning the latest sample
+func EMA(halfLife time.Duration) models.SmoothingFunc {
+	return func(samples []models.Sample, now time.Time) float64 {
+		if len(samples) == 0 {
+			return math.NaN()
+		}
+		if halfLife <= 0 {
+			return samples[len(samples)-1].Value
+		}
+
+		ema := samples[0].Value
+		for i := 1; i < len(samples); i++ {
+			elapsed := samples[i].Time.Sub(samples[i-1].Time)
+			alpha := 1 - math.Pow(2, -float64(elapsed)/float64(halfLife))
+			ema += alpha * (samples[i].Value - ema)
+		}
+		return ema
+	}
+}
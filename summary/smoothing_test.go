@@ -0,0 +1,48 @@
+package summary
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestTWAP(t *testing.T) {
+	now := time.Unix(1000, 0)
+	samples := []models.Sample{
+		{Time: now.Add(-40 * time.Minute), Value: 1000}, // holds for 10 minutes inside the window
+		{Time: now.Add(-20 * time.Minute), Value: 10},
+		{Time: now.Add(-10 * time.Minute), Value: 40},
+	}
+
+	result := TWAP(30*time.Minute)(samples, now)
+
+	expected := (1000*10 + 10*10 + 40*10) / 30.0
+	if math.Abs(result-expected) > 1e-9 {
+		t.Errorf("Incorrect TWAP, expected %v, got %v", expected, result)
+	}
+}
+
+func TestEMA(t *testing.T) {
+	now := time.Unix(1000, 0)
+	samples := []models.Sample{
+		{Time: now.Add(-time.Hour), Value: 100},
+		{Time: now, Value: 200},
+	}
+
+	result := EMA(time.Hour)(samples, now)
+
+	if math.Abs(result-150) > 1e-9 {
+		t.Errorf("Incorrect EMA, expected %v, got %v", 150, result)
+	}
+}
+
+func TestEMAWithoutHalfLife(t *testing.T) {
+	now := time.Unix(1000, 0)
+	samples := []models.Sample{{Time: now, Value: 100}, {Time: now, Value: 200}}
+
+	if result := EMA(0)(samples, now); result != 200 {
+		t.Errorf("Expected the latest sample without smoothing, got %v", result)
+	}
+}
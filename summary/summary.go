@@ -2,6 +2,7 @@ package summary
 
 import (
 	"math"
+	"sort"
 )
 
 // Mean: Returns the man of the dataset
@@ -37,6 +38,28 @@ func Mode(dataset []map[string]float64) map[string]float64 {
 	return result
 }
 
+// Max: Returns the largest value of the dataset
+func Max(dataset []map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+
+	for key, values := range groupByKey(dataset) {
+		result[key] = maxOfArray(values)
+	}
+
+	return result
+}
+
+// Min: Returns the smallest value of the dataset
+func Min(dataset []map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+
+	for key, values := range groupByKey(dataset) {
+		result[key] = minOfArray(values)
+	}
+
+	return result
+}
+
 // MeanWithoutOutliers: Returns the mean of the dataset after removing values outside 2 standard deviations from the median
 func MeanWithoutOutliers(dataset []map[string]float64) map[string]float64 {
 	result := make(map[string]float64)
@@ -86,8 +109,9 @@ func RemoveOutlier(dataset []float64) []float64 {
 
 	slicedData := make([]float64, 0)
 
-	median := medianOfArray(dataset)
-	for _, x := range dataset {
+	sortedData := sortedCopy(dataset)
+	median := medianOfArray(sortedData)
+	for _, x := range sortedData {
 		if median-(2*standardDeviation) <= x && x <= median+(2*standardDeviation) {
 			slicedData = append(slicedData, x)
 		}
@@ -109,6 +133,7 @@ func meanOfArray(dataset []float64) float64 {
 }
 
 func medianOfArray(dataset []float64) float64 {
+	dataset = sortedCopy(dataset)
 	if len(dataset)%2 == 0 {
 		return (dataset[len(dataset)/2] + dataset[(len(dataset)/2)-1]) / 2
 	} else {
@@ -130,3 +155,27 @@ func modeOfArray(dataset []float64) float64 {
 	}
 	return modeX
 }
+
+func maxOfArray(dataset []float64) float64 {
+	max := math.Inf(-1)
+	for _, x := range dataset {
+		max = math.Max(max, x)
+	}
+	return max
+}
+
+func minOfArray(dataset []float64) float64 {
+	min := math.Inf(1)
+	for _, x := range dataset {
+		min = math.Min(min, x)
+	}
+	return min
+}
+
+// sortedCopy: returns a sorted copy of the dataset, leaving the original untouched
+func sortedCopy(dataset []float64) []float64 {
+	result := make([]float64, len(dataset))
+	copy(result, dataset)
+	sort.Float64s(result)
+	return result
+}
@@ -1,6 +1,7 @@
 package summary
 
 import (
+	"math"
 	"reflect"
 	"testing"
 )
@@ -26,3 +27,61 @@ func TestRemoveOutlieSmall(t *testing.T) {
 		t.Errorf("Incorrect dataset from remove outlier, expected %v, got %v", expectedDataset, result)
 	}
 }
+
+func TestMedianUnsorted(t *testing.T) {
+	dataset := []map[string]float64{{"temp": 30}, {"temp": 10}, {"temp": 20}, {"temp": 50}}
+
+	result := Median(dataset)
+
+	if result["temp"] != 25 {
+		t.Errorf("Incorrect median, expected %v, got %v", 25, result["temp"])
+	}
+}
+
+func TestMaxMin(t *testing.T) {
+	dataset := []map[string]float64{{"gust": 12.5, "temp": -3}, {"gust": 40.1, "temp": -7}, {"gust": 3}}
+
+	max := Max(dataset)
+	min := Min(dataset)
+
+	if max["gust"] != 40.1 || max["temp"] != -3 {
+		t.Errorf("Incorrect max, got %v", max)
+	}
+	if min["gust"] != 3 || min["temp"] != -7 {
+		t.Errorf("Incorrect min, got %v", min)
+	}
+}
+
+func TestMeanWithoutOutliersDetailed(t *testing.T) {
+	dataset := []map[string]float64{{"price": 10}, {"price": 10}, {"price": 10}, {"price": 10}, {"price": 10}, {"price": 10000}}
+
+	result := MeanWithoutOutliersDetailed(dataset)["price"]
+
+	if result.Value != 10 || result.Sources != 5 || result.Rejected != 1 {
+		t.Errorf("Incorrect detailed result, got %+v", result)
+	}
+	if result.StdDev != 0 || result.Min != 10 || result.Max != 10 || result.ConfidenceLow != 10 || result.ConfidenceHigh != 10 {
+		t.Errorf("Incorrect dispersion metadata, got %+v", result)
+	}
+}
+
+func TestDetailed(t *testing.T) {
+	dataset := []map[string]float64{{"price": 1}, {"price": 3}}
+
+	result := Detailed(Max)(dataset)["price"]
+
+	if result.Value != 3 || result.Sources != 2 || result.Rejected != 0 || result.StdDev != 1 || result.Min != 1 || result.Max != 3 {
+		t.Errorf("Incorrect detailed result, got %+v", result)
+	}
+}
+
+func TestConfidenceIntervalAroundValue(t *testing.T) {
+	dataset := []map[string]float64{{"price": 1}, {"price": 3}}
+
+	result := Detailed(Max)(dataset)["price"]
+
+	margin := 1.96 / math.Sqrt(2)
+	if math.Abs(result.ConfidenceLow-(3-margin)) > 1e-9 || math.Abs(result.ConfidenceHigh-(3+margin)) > 1e-9 {
+		t.Errorf("Expected the confidence interval to be centred on the maximum, got %+v", result)
+	}
+}
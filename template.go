@@ -1,11 +1,51 @@
 package framework
 
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// CanisterTemplateData is the data available to the canister code template
+type CanisterTemplateData struct {
+	CanisterName string
+	Network      string
+}
+
+// requiredCanisterMethods are the public canister methods the framework calls, which every canister template must keep
+var requiredCanisterMethods = []string{
+	"update_map_value",
+	"get_map_value",
+	"get_map_field_value",
+	"get_map",
+	"assign_owner_role",
+	"assign_writer_role",
+	"revoke_writer_role",
+	"my_role",
+	"get_roles",
+	"self_destruct",
+}
+
+// CodeTemplate is the text/template source of the oracle canister code. It defines the following blocks, which a
+// custom template file can override with {{define "name"}}...{{end}}:
+//
+//	imports        extra import statements
+//	state          extra state declarations
+//	methods        extra public or private methods
+//	before_update  statements run at the start of update_map_value, after access checks (k, p and v are in scope)
+//	after_update   statements run at the end of update_map_value, after the value is stored
 const CodeTemplate = `// Import Base Modules
 import AssocList "mo:base/AssocList";
 import Error "mo:base/Error";
 import List "mo:base/List";
 import Option "mo:base/Option";
 import Text "mo:base/Text";
+{{- block "imports" .}}{{end}}
 
 shared (msg) actor class() {
     // Define custom types
@@ -19,11 +59,13 @@ shared (msg) actor class() {
     private stable var roles: AssocList.AssocList<Principal, Role> = List.nil();
     private stable var map: AssocList.AssocList<Text, AssocList.AssocList<Text, Float>> = List.nil();
     private stable var destructed: Bool = false;
+{{- block "state" .}}{{end}}
 
     // Favorite Cities Functions
     public shared ({caller}) func update_map_value(k: Text, p: Text, v: Float): async() {
         await require_role(caller, ?#writer);
         await require_undestructed();
+{{- block "before_update" .}}{{end}}
 
         var sublist: ?AssocList.AssocList<Text, Float> = AssocList.find<Text, AssocList.AssocList<Text, Float>>(map, k, text_eq);
         var newSublist: AssocList.AssocList<Text, Float> = List.nil();
@@ -37,6 +79,7 @@ shared (msg) actor class() {
             newSublist := AssocList.replace<Text, Float>(newSublist, p, text_eq, ?v).0;
             map := AssocList.replace<Text, AssocList.AssocList<Text, Float>>(map, k, text_eq, ?newSublist).0;
         };
+{{- block "after_update" .}}{{end}}
     };
 
     public func get_map_value(k: Text): async ?AssocList.AssocList<Text, Float> {
@@ -133,5 +176,83 @@ shared (msg) actor class() {
         destructed := true;
         map := List.nil();
         roles := List.nil();
-    }
+    };
+{{- block "methods" .}}{{end}}
 }`
+
+// CandidTemplate is the text/template source of the Candid interface of the canister generated from CodeTemplate. A
+// custom template file that adds methods to the canister can describe them by overriding its blocks:
+//
+//	candid_types    extra type definitions
+//	candid_methods  extra service methods
+const CandidTemplate = `type Role = variant { owner; writer };
+type Fields = opt record { record { text; float64 }; Fields };
+type Map = opt record { record { text; Fields }; Map };
+type Roles = opt record { record { principal; Role }; Roles };
+{{- block "candid_types" .}}{{end}}
+
+service : () -> {
+  update_map_value : (text, text, float64) -> ();
+  get_map_value : (text) -> (opt Fields);
+  get_map_field_value : (text, text) -> (opt float64);
+  get_map : () -> (Map);
+  assign_owner_role : () -> ();
+  assign_writer_role : (principal) -> ();
+  revoke_writer_role : (principal) -> ();
+  my_role : () -> (opt Role);
+  get_roles : () -> (Roles);
+  self_destruct : () -> ();
+{{- block "candid_methods" .}}{{end}}
+}
+`
+
+// renderCanister renders the canister code from CodeTemplate and its Candid interface from CandidTemplate, with the
+// configured template file layered over them, and checks that both still define every method the framework calls
+func renderCanister(config *models.Config) (code string, candid string, err error) {
+	tmpl, err := template.New("canister").Parse(CodeTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := tmpl.New("candid").Parse(CandidTemplate); err != nil {
+		return "", "", err
+	}
+	if config.CanisterTemplateFile != "" {
+		contents, err := ioutil.ReadFile(config.CanisterTemplateFile)
+		if err != nil {
+			return "", "", fmt.Errorf("Could not read canister template: %w", err)
+		}
+		if tmpl, err = tmpl.Parse(string(contents)); err != nil {
+			return "", "", fmt.Errorf("Could not parse canister template: %w", err)
+		}
+	}
+
+	data := CanisterTemplateData{CanisterName: config.CanisterName, Network: config.Network}
+	var codeBuffer, candidBuffer bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&codeBuffer, "canister", data); err != nil {
+		return "", "", fmt.Errorf("Could not render canister template: %w", err)
+	}
+	if err := tmpl.ExecuteTemplate(&candidBuffer, "candid", data); err != nil {
+		return "", "", fmt.Errorf("Could not render Candid template: %w", err)
+	}
+	code, candid = codeBuffer.String(), candidBuffer.String()
+
+	if missing := missingMethods(code, `public\s+(shared\s*(\([^)]*\)\s*)?)?func\s+%s\s*\(`); len(missing) > 0 {
+		return "", "", fmt.Errorf("Canister template is missing required methods: %s", strings.Join(missing, ", "))
+	}
+	if missing := missingMethods(candid, `(?m)^\s*%s\s*:`); len(missing) > 0 {
+		return "", "", fmt.Errorf("Candid template is missing required methods: %s", strings.Join(missing, ", "))
+	}
+	return code, candid, nil
+}
+
+// missingMethods returns the required methods whose declaration, given as a regular expression with a %s placeholder
+// for the method name, is not found in the given source
+func missingMethods(source string, declaration string) []string {
+	var missing []string
+	for _, method := range requiredCanisterMethods {
+		if !regexp.MustCompile(fmt.Sprintf(declaration, method)).MatchString(source) {
+			missing = append(missing, method)
+		}
+	}
+	return missing
+}
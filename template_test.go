@@ -0,0 +1,81 @@
+package framework
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func writeCanisterTemplate(t *testing.T, contents string) string {
+	fileName := filepath.Join(tempDir(t), "main.mo.tmpl")
+	if err := ioutil.WriteFile(fileName, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestRenderCanisterCodeExtensionBlocks(t *testing.T) {
+	fileName := writeCanisterTemplate(t, `
+{{define "imports"}}
+import Float "mo:base/Float";{{end}}
+{{define "state"}}
+    private stable var updates: Nat = 0;{{end}}
+{{define "after_update"}}
+        updates += 1;{{end}}
+{{define "methods"}}
+    public func {{.CanisterName}}_updates(): async Nat {
+        return updates;
+    };{{end}}`)
+
+	code, _, err := renderCanister(&models.Config{CanisterName: "weather", UpdateInterval: time.Minute, CanisterTemplateFile: fileName})
+	if err != nil {
+		t.Fatalf("Could not render canister code: %v", err)
+	}
+	for _, expected := range []string{
+		"import Text \"mo:base/Text\";\nimport Float \"mo:base/Float\";\n",
+		"private stable var updates: Nat = 0;",
+		"        };\n        updates += 1;\n    };",
+		"public func weather_updates(): async Nat {",
+	} {
+		if !strings.Contains(code, expected) {
+			t.Errorf("Expected canister code to contain %q", expected)
+		}
+	}
+}
+
+func TestRenderCanisterCodeRequiresMethods(t *testing.T) {
+	fileName := writeCanisterTemplate(t, `actor {
+    public shared ({caller}) func update_map_value(k: Text, p: Text, v: Float): async() {};
+    public func get_map(): async () {};
+}`)
+
+	_, _, err := renderCanister(&models.Config{CanisterName: "weather", UpdateInterval: time.Minute, CanisterTemplateFile: fileName})
+	if err == nil || !strings.Contains(err.Error(), "get_map_value, get_map_field_value, assign_owner_role") {
+		t.Errorf("Expected missing methods error, got %v", err)
+	}
+	if _, err := NewOracle(&models.Config{CanisterName: "weather", UpdateInterval: time.Minute, CanisterTemplateFile: fileName}, &models.Engine{}); err == nil {
+		t.Errorf("Expected NewOracle to reject the canister template")
+	}
+}
+
+func TestRenderCandidInterfaceExtensionBlocks(t *testing.T) {
+	fileName := writeCanisterTemplate(t, `
+{{define "methods"}}
+    public func update_count(): async Nat {
+        return 0;
+    };{{end}}
+{{define "candid_methods"}}
+  update_count : () -> (nat);{{end}}`)
+
+	_, candid, err := renderCanister(&models.Config{CanisterName: "weather", UpdateInterval: time.Minute, CanisterTemplateFile: fileName})
+	if err != nil {
+		t.Fatalf("Could not render canister code: %v", err)
+	}
+	if !strings.Contains(candid, "  self_destruct : () -> ();\n  update_count : () -> (nat);\n}") {
+		t.Errorf("Expected Candid interface to contain the extra method, got %s", candid)
+	}
+}
@@ -0,0 +1,32 @@
+package framework
+
+import (
+	"fmt"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+	"github.com/hyplabs/dfinity-oracle-framework/utils"
+)
+
+// newClients creates the HTTP clients for the endpoints of the given engine, returning an error if the transport
+// settings of any of them are invalid
+func newClients(config *models.Config, engine *models.Engine) (*utils.Clients, error) {
+	clients := utils.NewClients(config.Transport)
+	if _, err := clients.Client(nil); err != nil {
+		return nil, fmt.Errorf("Invalid transport settings: %w", err)
+	}
+	for _, meta := range engine.Metadata {
+		for _, endpoint := range meta.Endpoints {
+			if _, err := clients.Client(endpoint.Transport); err != nil {
+				return nil, fmt.Errorf("Invalid transport settings of endpoint %s of key %s: %w", endpoint.Endpoint, meta.Key, err)
+			}
+		}
+	}
+	return clients, nil
+}
+
+// httpClients returns the current HTTP clients for endpoints
+func (o *Oracle) httpClients() *utils.Clients {
+	o.engineMu.RLock()
+	defer o.engineMu.RUnlock()
+	return o.clients
+}
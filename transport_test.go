@@ -0,0 +1,50 @@
+package framework
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestRoundUsesTransportSettings(t *testing.T) {
+	_, restore := fakeDfx(t, `true`)
+	defer restore()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"v": 10}`))
+	}))
+	defer server.Close()
+	ca := filepath.Join(tempDir(t), "ca.pem")
+	if err := ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	engine := &models.Engine{Metadata: []models.MappingMetadata{
+		{Key: "trusted", Endpoints: []models.Endpoint{{Endpoint: server.URL + "/a", JSONPaths: map[string]string{"v": "$.v"}}}},
+		{Key: "untrusted", Endpoints: []models.Endpoint{{Endpoint: server.URL + "/b", JSONPaths: map[string]string{"v": "$.v"}, Transport: &models.Transport{RootCAFiles: []string{}}}}},
+	}}
+	o := newTestOracle(t, &models.Config{CanisterName: ".", Transport: &models.Transport{RootCAFiles: []string{ca}}}, engine)
+
+	o.RunOnce(context.Background())
+
+	status := o.ServiceStatus().Keys
+	if len(status) != 2 || !status[0].Success || status[1].Success {
+		t.Errorf("Expected only the key using the default root CAs to be updated, got %+v", status)
+	}
+}
+
+func TestNewOracleRejectsInvalidTransport(t *testing.T) {
+	missing := &models.Transport{ClientCertFile: "missing.pem", ClientKeyFile: "missing-key.pem"}
+	if _, err := NewOracle(&models.Config{CanisterName: "test", UpdateInterval: time.Minute, Transport: missing}, &models.Engine{}); err == nil {
+		t.Errorf("Expected an error for invalid default transport settings")
+	}
+	engine := &models.Engine{Metadata: []models.MappingMetadata{{Key: "a", Endpoints: []models.Endpoint{{Endpoint: "https://a.example", Transport: missing}}}}}
+	if _, err := NewOracle(&models.Config{CanisterName: "test", UpdateInterval: time.Minute}, engine); err == nil {
+		t.Errorf("Expected an error for invalid transport settings of an endpoint")
+	}
+}
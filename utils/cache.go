@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// ResponseCache caches the responses of endpoints to avoid requesting data more often than it changes. A response is
+// reused without a request while it is fresh: for the max-age of its Cache-Control header (less its Age), or for the
+// endpoint's MinRefresh, whichever is longer. After that, it is revalidated with If-None-Match or If-Modified-Since if
+// it had an ETag or Last-Modified header, and reused if the endpoint responds with 304 Not Modified. Responses marked
+// no-store are only kept for MinRefresh, and responses to requests other than GET (e.g. a JSON-RPC POST) are only kept
+// for MinRefresh, without revalidation.
+type ResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	now     func() time.Time
+}
+
+type cacheEntry struct {
+	body         []byte
+	etag         string
+	lastModified string
+	freshUntil   time.Time
+}
+
+// NewResponseCache creates an empty response cache
+func NewResponseCache() *ResponseCache {
+	return &ResponseCache{entries: make(map[string]*cacheEntry), now: time.Now}
+}
+
+// Fresh returns the cached body of the response of the given endpoint, if it is still fresh
+func (c *ResponseCache) Fresh(e models.Endpoint) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[RequestKey(e)]
+	if !ok || !c.now().Before(entry.freshUntil) {
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// FetchEndpoint is like the FetchEndpoint function, but sends requests with the given client and uses the cache.
+// notModified reports whether the body came from the cache, either because it was still fresh or because the endpoint
+// responded that it had not changed.
+func (c *ResponseCache) FetchEndpoint(ctx context.Context, client *http.Client, e models.Endpoint) (body []byte, notModified bool, err error) {
+	if !cacheable(e) {
+		resp, err := sendRequest(ctx, client, e, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		return resp.body, false, nil
+	}
+	if body, ok := c.Fresh(e); ok {
+		return body, true, nil
+	}
+
+	key := RequestKey(e)
+	c.mu.Lock()
+	cached := c.entries[key]
+	c.mu.Unlock()
+	get := isGet(e)
+	conditions := make(map[string]string)
+	if get && cached != nil && cached.etag != "" {
+		conditions["If-None-Match"] = cached.etag
+	}
+	if get && cached != nil && cached.lastModified != "" {
+		conditions["If-Modified-Since"] = cached.lastModified
+	}
+
+	resp, err := sendRequest(ctx, client, e, conditions)
+	if err != nil {
+		return nil, false, err
+	}
+	entry := &cacheEntry{body: resp.body, etag: resp.header.Get("ETag"), lastModified: resp.header.Get("Last-Modified")}
+	if resp.status == http.StatusNotModified {
+		entry.body, notModified = cached.body, true
+		if entry.etag == "" {
+			entry.etag = cached.etag
+		}
+		if entry.lastModified == "" {
+			entry.lastModified = cached.lastModified
+		}
+	}
+
+	now := c.now()
+	maxAge, store := freshness(resp.header)
+	if !get {
+		maxAge, store = 0, false
+	}
+	if maxAge < e.MinRefresh {
+		maxAge = e.MinRefresh
+	}
+	entry.freshUntil = now.Add(maxAge)
+	c.mu.Lock()
+	if store || e.MinRefresh > 0 {
+		c.entries[key] = entry
+	} else {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	return entry.body, notModified, nil
+}
+
+func cacheable(e models.Endpoint) bool {
+	return isGet(e) || e.MinRefresh > 0
+}
+
+func isGet(e models.Endpoint) bool {
+	return e.Method == "" || strings.EqualFold(e.Method, http.MethodGet)
+}
+
+// freshness returns how long a response stays fresh according to its Cache-Control and Age headers, and whether it
+// may be stored at all
+func freshness(header http.Header) (time.Duration, bool) {
+	var maxAge time.Duration
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-store":
+			return 0, false
+		case directive == "no-cache":
+			// stored, but revalidated every time
+			return 0, true
+		case strings.HasPrefix(directive, "max-age="):
+			if seconds, err := strconv.Atoi(strings.Trim(directive[len("max-age="):], `"`)); err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+		maxAge -= time.Duration(age) * time.Second
+	}
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	return maxAge, true
+}
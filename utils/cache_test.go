@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// testCache returns a cache with a clock that the returned function advances
+func testCache() (*ResponseCache, func(time.Duration)) {
+	c := NewResponseCache()
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestResponseCacheHonoursMaxAge(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Age", "10")
+		w.Write([]byte(`{"v": 1}`))
+	}))
+	defer server.Close()
+	c, advance := testCache()
+	e := models.Endpoint{Endpoint: server.URL}
+
+	if _, notModified, err := c.FetchEndpoint(context.Background(), http.DefaultClient, e); err != nil || notModified {
+		t.Fatalf("Expected the first request to be sent, got %v", err)
+	}
+	advance(49 * time.Second)
+	if body, notModified, err := c.FetchEndpoint(context.Background(), http.DefaultClient, e); err != nil || !notModified || string(body) != `{"v": 1}` {
+		t.Errorf("Expected the response to be reused, got %q, %v", body, err)
+	}
+	advance(2 * time.Second)
+	c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+	if requests != 2 {
+		t.Errorf("Expected the response to be requested again after max-age less its age, got %d requests", requests)
+	}
+}
+
+func TestResponseCacheRevalidates(t *testing.T) {
+	var conditions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match")+"|"+r.Header.Get("If-Modified-Since"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Fri, 01 Mar 2024 11:00:00 GMT")
+		w.Write([]byte(`{"v": 1}`))
+	}))
+	defer server.Close()
+	c, _ := testCache()
+	e := models.Endpoint{Endpoint: server.URL}
+
+	c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+	body, notModified, err := c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+	if err != nil || !notModified || string(body) != `{"v": 1}` {
+		t.Errorf("Expected the cached body to be reused on 304, got %q, %v", body, err)
+	}
+	expected := []string{"|", `"v1"|Fri, 01 Mar 2024 11:00:00 GMT`}
+	if len(conditions) != 2 || conditions[0] != expected[0] || conditions[1] != expected[1] {
+		t.Errorf("Expected %v to be sent, got %v", expected, conditions)
+	}
+}
+
+func TestResponseCacheMinRefresh(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(`{"v": 1}`))
+	}))
+	defer server.Close()
+	c, advance := testCache()
+
+	for _, e := range []models.Endpoint{
+		{Endpoint: server.URL + "/get", MinRefresh: time.Hour},
+		{Endpoint: server.URL + "/rpc", Method: "POST", Body: "{}", MinRefresh: time.Hour},
+	} {
+		requests = 0
+		c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+		advance(59 * time.Minute)
+		c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+		if requests != 1 {
+			t.Errorf("Expected %s to be requested once within its minimum refresh period, got %d requests", e.Endpoint, requests)
+		}
+		advance(2 * time.Minute)
+		c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+		if requests != 2 {
+			t.Errorf("Expected %s to be requested again after its minimum refresh period, got %d requests", e.Endpoint, requests)
+		}
+	}
+
+	requests = 0
+	e := models.Endpoint{Endpoint: server.URL + "/uncached"}
+	c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+	c.FetchEndpoint(context.Background(), http.DefaultClient, e)
+	if _, ok := c.Fresh(e); requests != 2 || ok {
+		t.Errorf("Expected no-store responses not to be cached, got %d requests", requests)
+	}
+}
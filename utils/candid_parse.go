@@ -0,0 +1,370 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CandidOpt is a parsed Candid `opt` value holding a value
+type CandidOpt struct {
+	Value interface{}
+}
+
+// CandidField is a field of a parsed Candid record; fields without a name are named by their position
+type CandidField struct {
+	Name  string
+	Value interface{}
+}
+
+// CandidRecord is a parsed Candid record, with its fields in order
+type CandidRecord []CandidField
+
+// CandidVariant is a parsed Candid variant
+type CandidVariant struct {
+	Name  string
+	Value interface{}
+}
+
+// CandidPrincipalValue is a parsed Candid principal
+type CandidPrincipalValue string
+
+// ParseCandid parses the textual Candid values printed by `dfx canister call`, such as `(opt (1.5 : float64))`.
+// Values are returned as nil (null), bool, float64 (all numbers), string (text and blob), CandidPrincipalValue,
+// CandidOpt, CandidRecord, CandidVariant, or []interface{} (vec). Type annotations are skipped.
+func ParseCandid(text string) ([]interface{}, error) {
+	p := &candidParser{input: text}
+	p.skipSpace()
+	if !p.consume('(') {
+		// a single value printed without the enclosing tuple
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.end(); err != nil {
+			return nil, err
+		}
+		return []interface{}{value}, nil
+	}
+
+	values := []interface{}{}
+	for !p.consume(')') {
+		value, err := p.annotatedValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !p.consume(',') && p.peek() != ')' {
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+type candidParser struct {
+	input string
+	pos   int
+}
+
+func (p *candidParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("Invalid Candid value at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *candidParser) skipSpace() {
+	for p.pos < len(p.input) {
+		r, size := utf8.DecodeRuneInString(p.input[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of the input
+func (p *candidParser) peek() byte {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *candidParser) consume(c byte) bool {
+	if p.peek() != c {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *candidParser) end() error {
+	if p.peek() != 0 {
+		return p.errorf("unexpected trailing input")
+	}
+	return nil
+}
+
+func isCandidIdentByte(c byte) bool {
+	return c == '_' || c == '.' || c == '+' || c == '-' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// word returns the next identifier or number, without consuming it
+func (p *candidParser) word() string {
+	p.skipSpace()
+	end := p.pos
+	for end < len(p.input) && isCandidIdentByte(p.input[end]) {
+		end++
+	}
+	return p.input[p.pos:end]
+}
+
+// annotatedValue parses a value that may be followed by a type annotation
+func (p *candidParser) annotatedValue() (interface{}, error) {
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.consume(':') {
+		p.skipType()
+	}
+	return value, nil
+}
+
+// skipType skips a type annotation, up to the next separator outside of braces or parentheses
+func (p *candidParser) skipType() {
+	depth := 0
+	for p.pos < len(p.input) {
+		switch p.input[p.pos] {
+		case '{', '(':
+			depth++
+		case '}', ')':
+			if depth == 0 {
+				return
+			}
+			depth--
+		case ';', ',':
+			if depth == 0 {
+				return
+			}
+		}
+		p.pos++
+	}
+}
+
+func (p *candidParser) value() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, p.errorf("unexpected end of input")
+	case c == '(':
+		p.pos++
+		value, err := p.annotatedValue()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(')') {
+			return nil, p.errorf("expected ')'")
+		}
+		return value, nil
+	case c == '"':
+		return p.text()
+	}
+
+	word := p.word()
+	switch word {
+	case "":
+		return nil, p.errorf("unexpected character %q", p.input[p.pos])
+	case "null":
+		p.pos += len(word)
+		return nil, nil
+	case "true", "false":
+		p.pos += len(word)
+		return word == "true", nil
+	case "opt":
+		p.pos += len(word)
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return CandidOpt{Value: value}, nil
+	case "principal":
+		p.pos += len(word)
+		principal, err := p.text()
+		if err != nil {
+			return nil, err
+		}
+		return CandidPrincipalValue(principal), nil
+	case "blob":
+		p.pos += len(word)
+		return p.text()
+	case "record":
+		p.pos += len(word)
+		return p.record()
+	case "variant":
+		p.pos += len(word)
+		return p.variant()
+	case "vec":
+		p.pos += len(word)
+		return p.vec()
+	}
+
+	number, err := strconv.ParseFloat(strings.ReplaceAll(word, "_", ""), 64)
+	if err != nil {
+		return nil, p.errorf("unexpected %q", word)
+	}
+	p.pos += len(word)
+	return number, nil
+}
+
+func (p *candidParser) text() (string, error) {
+	if !p.consume('"') {
+		return "", p.errorf("expected '\"'")
+	}
+	var result strings.Builder
+	for p.pos < len(p.input) {
+		c := p.input[p.pos]
+		p.pos++
+		switch c {
+		case '"':
+			return result.String(), nil
+		case '\\':
+			if err := p.escape(&result); err != nil {
+				return "", err
+			}
+		default:
+			result.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated text")
+}
+
+func (p *candidParser) escape(result *strings.Builder) error {
+	if p.pos >= len(p.input) {
+		return p.errorf("unterminated escape")
+	}
+	c := p.input[p.pos]
+	p.pos++
+	switch c {
+	case 'n':
+		result.WriteByte('\n')
+	case 'r':
+		result.WriteByte('\r')
+	case 't':
+		result.WriteByte('\t')
+	case '\\', '"', '\'':
+		result.WriteByte(c)
+	case 'u':
+		end := strings.IndexByte(p.input[p.pos:], '}')
+		if !strings.HasPrefix(p.input[p.pos:], "{") || end < 0 {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(strings.ReplaceAll(p.input[p.pos+1:p.pos+end], "_", ""), 16, 32)
+		if err != nil {
+			return p.errorf("invalid unicode escape")
+		}
+		result.WriteRune(rune(code))
+		p.pos += end + 1
+	default:
+		if p.pos >= len(p.input) {
+			return p.errorf("invalid escape")
+		}
+		b, err := strconv.ParseUint(p.input[p.pos-1:p.pos+1], 16, 8)
+		if err != nil {
+			return p.errorf("invalid escape")
+		}
+		result.WriteByte(byte(b))
+		p.pos++
+	}
+	return nil
+}
+
+// fieldName consumes a field name followed by '=', if there is one
+func (p *candidParser) fieldName() (string, bool) {
+	start := p.pos
+	var name string
+	if p.peek() == '"' {
+		text, err := p.text()
+		if err != nil {
+			p.pos = start
+			return "", false
+		}
+		name = text
+	} else {
+		name = p.word()
+		p.pos += len(name)
+	}
+	if name == "" || !p.consume('=') {
+		p.pos = start
+		return "", false
+	}
+	return name, true
+}
+
+func (p *candidParser) record() (CandidRecord, error) {
+	if !p.consume('{') {
+		return nil, p.errorf("expected '{'")
+	}
+	record := CandidRecord{}
+	for !p.consume('}') {
+		name, ok := p.fieldName()
+		if !ok {
+			name = strconv.Itoa(len(record))
+		}
+		value, err := p.annotatedValue()
+		if err != nil {
+			return nil, err
+		}
+		record = append(record, CandidField{Name: name, Value: value})
+		if !p.consume(';') && p.peek() != '}' {
+			return nil, p.errorf("expected ';' or '}'")
+		}
+	}
+	return record, nil
+}
+
+func (p *candidParser) variant() (CandidVariant, error) {
+	if !p.consume('{') {
+		return CandidVariant{}, p.errorf("expected '{'")
+	}
+	var variant CandidVariant
+	if name, ok := p.fieldName(); ok {
+		value, err := p.annotatedValue()
+		if err != nil {
+			return CandidVariant{}, err
+		}
+		variant = CandidVariant{Name: name, Value: value}
+	} else {
+		variant.Name = p.word()
+		if variant.Name == "" {
+			return CandidVariant{}, p.errorf("expected variant name")
+		}
+		p.pos += len(variant.Name)
+	}
+	p.consume(';')
+	if !p.consume('}') {
+		return CandidVariant{}, p.errorf("expected '}'")
+	}
+	return variant, nil
+}
+
+func (p *candidParser) vec() ([]interface{}, error) {
+	if !p.consume('{') {
+		return nil, p.errorf("expected '{'")
+	}
+	values := []interface{}{}
+	for !p.consume('}') {
+		value, err := p.annotatedValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		if !p.consume(';') && p.peek() != '}' {
+			return nil, p.errorf("expected ';' or '}'")
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCandid(t *testing.T) {
+	cases := []struct {
+		text     string
+		expected []interface{}
+	}{
+		{"(null)", []interface{}{nil}},
+		{"(opt 21.5)\n", []interface{}{CandidOpt{21.5}}},
+		{"(opt (21.5 : float64))", []interface{}{CandidOpt{21.5}}},
+		{"(opt 21.5 : opt float64)", []interface{}{CandidOpt{21.5}}},
+		{"(1_000 : nat, true)", []interface{}{1000.0, true}},
+		{`("a\"b\u{E9}\4e")`, []interface{}{"a\"béN"}},
+		{"(opt variant { owner })", []interface{}{CandidOpt{CandidVariant{Name: "owner"}}}},
+		{`(principal "aaaaa-aa")`, []interface{}{CandidPrincipalValue("aaaaa-aa")}},
+		{`(vec { 1; 2 })`, []interface{}{[]interface{}{1.0, 2.0}}},
+		{
+			`(opt record { record { "price"; -1.5 : float64 }; null })`,
+			[]interface{}{CandidOpt{CandidRecord{{"0", CandidRecord{{"0", "price"}, {"1", -1.5}}}, {"1", nil}}}},
+		},
+		{
+			`(record { 0 = "price"; name = variant { ok = 2.0 }; })`,
+			[]interface{}{CandidRecord{{"0", "price"}, {"name", CandidVariant{"ok", 2.0}}}},
+		},
+	}
+	for _, c := range cases {
+		actual, err := ParseCandid(c.text)
+		if err != nil {
+			t.Errorf("Could not parse %s: %v", c.text, err)
+		} else if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Incorrect result for %s: %#v", c.text, actual)
+		}
+	}
+
+	for _, text := range []string{"(", "(opt)", `("abc)`, "(1 2)", "(record { 1 )", "(nonsense)"} {
+		if _, err := ParseCandid(text); err == nil {
+			t.Errorf("Expected error for %s", text)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/hyplabs/dfinity-oracle-framework/expr"
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// NewExpressionNormalizer compiles the expressions of the given endpoint into a normalization function, returning an
+// error if any expression is invalid or references a field that isn't extracted by the endpoint's JSONPaths
+func NewExpressionNormalizer(e models.Endpoint) (func(map[string]interface{}) (map[string]float64, error), error) {
+	fields := make([]string, 0, len(e.Expressions))
+	for field := range e.Expressions {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	compiled := make(map[string]*expr.Expr)
+	for _, field := range fields {
+		compiledExpr, err := expr.Compile(e.Expressions[field])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field, err)
+		}
+		for _, name := range compiledExpr.Vars() {
+			if _, ok := e.JSONPaths[name]; !ok {
+				return nil, fmt.Errorf("field %s: %s is not one of the endpoint's JSONPaths", field, name)
+			}
+		}
+		compiled[field] = compiledExpr
+	}
+
+	return func(values map[string]interface{}) (map[string]float64, error) {
+		vars := make(map[string]float64)
+		for name, value := range values {
+			number, err := ToFloat64(value)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			vars[name] = number
+		}
+
+		result := make(map[string]float64)
+		for field, compiledExpr := range compiled {
+			value, err := compiledExpr.Eval(vars)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", field, err)
+			}
+			result[field] = value
+		}
+		return result, nil
+	}, nil
+}
+
+// ToFloat64 converts a value extracted from a JSON response into a float64, accepting numbers, numeric strings and
+// booleans
+func ToFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not a number", v)
+		}
+		return number, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("value %v of type %T is not a number", value, value)
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestExpressionNormalizer(t *testing.T) {
+	endpoint := models.Endpoint{
+		JSONPaths: map[string]string{"bid": "$.bid", "ask": "$.ask", "temp_f": "$.temp"},
+		Expressions: map[string]string{
+			"price":               "(bid + ask) / 2",
+			"temperature_celsius": "f_to_c(temp_f)",
+		},
+	}
+
+	normalize, err := NewExpressionNormalizer(endpoint)
+	if err != nil {
+		t.Fatalf("Could not compile normalizer: %v", err)
+	}
+	result, err := normalize(map[string]interface{}{"bid": "99.5", "ask": 100.5, "temp_f": 50.0})
+	if err != nil {
+		t.Fatalf("Could not normalize: %v", err)
+	}
+
+	if len(result) != 2 || result["price"] != 100 || result["temperature_celsius"] != 10 {
+		t.Errorf("Incorrect normalized result %v", result)
+	}
+}
+
+func TestExpressionNormalizerRejectsUnknownFields(t *testing.T) {
+	endpoint := models.Endpoint{
+		JSONPaths:   map[string]string{"bid": "$.bid"},
+		Expressions: map[string]string{"price": "(bid + ask) / 2"},
+	}
+
+	if _, err := NewExpressionNormalizer(endpoint); err == nil {
+		t.Errorf("Expected an error for an expression referencing an unknown field")
+	}
+}
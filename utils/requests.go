@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// RequestGroup coalesces identical requests to endpoints: a request with the same RequestKey as one already made
+// through the group shares its response, or waits for it if it is still in flight, instead of being sent again. A group
+// is meant to last for a single update round, so that every round still sees fresh data.
+type RequestGroup struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// NewRequestGroup creates an empty request group
+func NewRequestGroup() *RequestGroup {
+	return &RequestGroup{calls: make(map[string]*call)}
+}
+
+// Do returns the response body of the request to the given endpoint, calling fetch to retrieve it unless an identical
+// request was already made through the group. shared reports whether the response came from another request.
+func (g *RequestGroup) Do(e models.Endpoint, fetch func() ([]byte, error)) (body []byte, shared bool, err error) {
+	key := RequestKey(e)
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.body, true, c.err
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.body, c.err = fetch()
+	close(c.done)
+	return c.body, false, c.err
+}
+
+// RequestKey identifies the request made to an endpoint by its method, URL, headers, body and transport settings, which
+// may e.g. present a different client certificate
+func RequestKey(e models.Endpoint) string {
+	method := strings.ToUpper(e.Method)
+	if method == "" {
+		method = "GET"
+	}
+	names := make([]string, 0, len(e.Headers))
+	for name := range e.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	key.WriteString(method + " " + e.Endpoint + "\n")
+	for _, name := range names {
+		// header names are case-insensitive
+		key.WriteString(strings.ToLower(name) + ": " + e.Headers[name] + "\n")
+	}
+	key.WriteString("\n" + e.Body)
+	if e.Transport != nil {
+		transport, _ := json.Marshal(e.Transport)
+		key.WriteString("\n" + string(transport))
+	}
+	return key.String()
+}
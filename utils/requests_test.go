@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+func TestRequestKey(t *testing.T) {
+	base := models.Endpoint{Endpoint: "https://api.example.com/ticker", Headers: map[string]string{"X-Api-Key": "k", "Accept": "application/json"}}
+	same := models.Endpoint{Endpoint: "https://api.example.com/ticker", Method: "get", Headers: map[string]string{"accept": "application/json", "x-api-key": "k"}, JSONPaths: map[string]string{"p": "$.p"}}
+	if RequestKey(base) != RequestKey(same) {
+		t.Errorf("Expected requests differing only in JSONPaths, method case and header order to be identical")
+	}
+	different := []models.Endpoint{
+		{Endpoint: "https://api.example.com/ticker?pair=ETH", Headers: base.Headers},
+		{Endpoint: base.Endpoint, Method: "POST", Headers: base.Headers},
+		{Endpoint: base.Endpoint, Headers: map[string]string{"X-Api-Key": "other", "Accept": "application/json"}},
+		{Endpoint: base.Endpoint, Headers: base.Headers, Body: "{}"},
+	}
+	for _, e := range different {
+		if RequestKey(e) == RequestKey(base) {
+			t.Errorf("Expected %+v to be a different request", e)
+		}
+	}
+}
+
+func TestRequestGroupSharesResponses(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if body, _ := ioutil.ReadAll(r.Body); r.Method != "POST" || r.Header.Get("X-Api-Key") != "k" || string(body) != `{"pairs":["BTC","ETH"]}` {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"BTC": 60000, "ETH": 3000}`))
+	}))
+	defer server.Close()
+
+	g := NewRequestGroup()
+	var wg sync.WaitGroup
+	results := make([]map[string]float64, 2)
+	for i, coin := range []string{"BTC", "ETH"} {
+		wg.Add(1)
+		go func(i int, coin string) {
+			defer wg.Done()
+			e := models.Endpoint{Endpoint: server.URL, Method: "POST", Headers: map[string]string{"X-Api-Key": "k"}, Body: `{"pairs":["BTC","ETH"]}`, JSONPaths: map[string]string{"price": "$." + coin}}
+			body, _, err := g.Do(e, func() ([]byte, error) { return FetchEndpoint(context.Background(), e) })
+			if err != nil {
+				t.Errorf("Could not fetch %s: %v", coin, err)
+				return
+			}
+			results[i], err = ParseAPIInfo(body, e)
+			if err != nil {
+				t.Errorf("Could not parse %s: %v", coin, err)
+			}
+		}(i, coin)
+	}
+	wg.Wait()
+
+	if requests != 1 {
+		t.Errorf("Expected a single request, got %d", requests)
+	}
+	if results[0]["price"] != 60000 || results[1]["price"] != 3000 {
+		t.Errorf("Incorrect results %v", results)
+	}
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// defaultClients are the clients used by FetchEndpoint
+var defaultClients = NewClients(nil)
+
+// Clients creates the HTTP clients that send requests to endpoints, one per distinct models.Transport, so that
+// connections are reused across requests. Certificate files are read when a client is first created.
+type Clients struct {
+	defaults *models.Transport
+	mu       sync.Mutex
+	clients  map[string]*http.Client
+}
+
+// NewClients creates the clients for endpoints, which use the given default transport settings unless they override
+// them
+func NewClients(defaults *models.Transport) *Clients {
+	return &Clients{defaults: defaults, clients: make(map[string]*http.Client)}
+}
+
+// Client returns the client for requests with the given transport settings, which may be nil, layered over the
+// defaults. It returns an error if the settings are invalid, e.g. if a certificate file can't be read.
+func (c *Clients) Client(t *models.Transport) (*http.Client, error) {
+	t = mergeTransports(c.defaults, t)
+	if t == nil {
+		return http.DefaultClient, nil
+	}
+	id, _ := json.Marshal(t)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[string(id)]; ok {
+		return client, nil
+	}
+	client, err := newClient(t)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[string(id)] = client
+	return client, nil
+}
+
+// mergeTransports returns the default settings overridden by the settings t sets
+func mergeTransports(defaults *models.Transport, t *models.Transport) *models.Transport {
+	if defaults == nil || t == nil {
+		if defaults != nil {
+			return defaults
+		}
+		return t
+	}
+	merged := *defaults
+	if t.RootCAFiles != nil {
+		merged.RootCAFiles = t.RootCAFiles
+	}
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		merged.ClientCertFile, merged.ClientKeyFile = t.ClientCertFile, t.ClientKeyFile
+	}
+	if t.MinTLSVersion != "" {
+		merged.MinTLSVersion = t.MinTLSVersion
+	}
+	if t.PinnedKeys != nil {
+		merged.PinnedKeys = t.PinnedKeys
+	}
+	if t.ProxyURL != "" {
+		merged.ProxyURL = t.ProxyURL
+	}
+	return &merged
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func newClient(t *models.Transport) (*http.Client, error) {
+	config := &tls.Config{}
+	if len(t.RootCAFiles) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		for _, file := range t.RootCAFiles {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("Could not read root CA file: %w", err)
+			}
+			if !config.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("Root CA file %s contains no PEM certificates", file)
+			}
+		}
+	}
+	if t.ClientCertFile != "" || t.ClientKeyFile != "" {
+		if t.ClientCertFile == "" || t.ClientKeyFile == "" {
+			return nil, fmt.Errorf("A client certificate requires both a certificate file and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(t.ClientCertFile, t.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if t.MinTLSVersion != "" {
+		version, ok := tlsVersions[t.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("Unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", t.MinTLSVersion)
+		}
+		config.MinVersion = version
+	}
+	if len(t.PinnedKeys) > 0 {
+		pins := make([][]byte, 0, len(t.PinnedKeys))
+		for _, pin := range t.PinnedKeys {
+			hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("Pinned key %q is not a base64 SHA-256 hash", pin)
+			}
+			pins = append(pins, hash)
+		}
+		config.VerifyPeerCertificate = verifyPinnedKeys(pins)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	if t.ProxyURL != "" {
+		proxy, err := url.Parse(t.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy URL: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("Invalid proxy URL %q, expected an http, https or socks5 URL", t.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// verifyPinnedKeys returns a tls.Config.VerifyPeerCertificate function that accepts a certificate chain, which was
+// already verified against the root CAs, only if one of its certificates has one of the pinned public keys
+func verifyPinnedKeys(pins [][]byte) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, chain := range verifiedChains {
+			for _, cert := range chain {
+				hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				for _, pin := range pins {
+					if bytes.Equal(hash[:], pin) {
+						return nil
+					}
+				}
+			}
+		}
+		return fmt.Errorf("Certificate chain does not contain a pinned public key")
+	}
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyplabs/dfinity-oracle-framework/models"
+)
+
+// writePEM writes a PEM block to a file in dir, returning its path
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeClientCert generates a self-signed client certificate, returning it along with the paths of its files
+func writeClientCert(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "oracle"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func fetchWith(t *testing.T, clients *Clients, e models.Endpoint) ([]byte, error) {
+	client, err := clients.Client(e.Transport)
+	if err != nil {
+		t.Fatalf("Invalid transport %+v: %v", e.Transport, err)
+	}
+	resp, err := sendRequest(context.Background(), client, e, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+func TestClientsTrustRootCAs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"v": 1}`))
+	}))
+	defer server.Close()
+	ca := writePEM(t, tempDir(t), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	if _, err := fetchWith(t, NewClients(nil), models.Endpoint{Endpoint: server.URL}); err == nil {
+		t.Errorf("Expected the test server not to be trusted by default")
+	}
+	clients := NewClients(&models.Transport{RootCAFiles: []string{ca}})
+	if body, err := fetchWith(t, clients, models.Endpoint{Endpoint: server.URL}); err != nil || string(body) != `{"v": 1}` {
+		t.Errorf("Expected the default root CAs to be trusted, got %q, %v", body, err)
+	}
+	if _, err := fetchWith(t, clients, models.Endpoint{Endpoint: server.URL, Transport: &models.Transport{RootCAFiles: []string{}}}); err == nil {
+		t.Errorf("Expected the endpoint's root CAs to override the defaults")
+	}
+}
+
+func TestClientsPresentClientCertificate(t *testing.T) {
+	dir := tempDir(t)
+	cert, certFile, keyFile := writeClientCert(t, dir)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	ca := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	clients := NewClients(&models.Transport{RootCAFiles: []string{ca}})
+
+	if _, err := fetchWith(t, clients, models.Endpoint{Endpoint: server.URL}); err == nil {
+		t.Errorf("Expected the server to require a client certificate")
+	}
+	e := models.Endpoint{Endpoint: server.URL, Transport: &models.Transport{ClientCertFile: certFile, ClientKeyFile: keyFile}}
+	if body, err := fetchWith(t, clients, e); err != nil || string(body) != "oracle" {
+		t.Errorf("Expected the client certificate to be presented, got %q, %v", body, err)
+	}
+}
+
+func TestClientsRequireMinTLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	ca := writePEM(t, tempDir(t), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	for version, ok := range map[string]bool{"1.2": true, "1.3": false} {
+		clients := NewClients(&models.Transport{RootCAFiles: []string{ca}, MinTLSVersion: version})
+		if _, err := fetchWith(t, clients, models.Endpoint{Endpoint: server.URL}); (err == nil) != ok {
+			t.Errorf("Expected a TLS 1.2 server to be accepted with a minimum of TLS %s: %v, got %v", version, ok, err)
+		}
+	}
+}
+
+func TestClientsPinKeys(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	ca := writePEM(t, tempDir(t), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	hash := sha256.Sum256(server.Certificate().RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(hash[:])
+	other := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	for _, pins := range [][]string{{pin}, {other, "sha256/" + pin}} {
+		clients := NewClients(&models.Transport{RootCAFiles: []string{ca}, PinnedKeys: pins})
+		if _, err := fetchWith(t, clients, models.Endpoint{Endpoint: server.URL}); err != nil {
+			t.Errorf("Expected the pinned key to be accepted with pins %v, got %v", pins, err)
+		}
+	}
+	clients := NewClients(&models.Transport{RootCAFiles: []string{ca}, PinnedKeys: []string{other}})
+	if _, err := fetchWith(t, clients, models.Endpoint{Endpoint: server.URL}); err == nil {
+		t.Errorf("Expected a certificate without a pinned key to be rejected")
+	}
+}
+
+func TestClientsUseProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.Write([]byte(`{"v": 1}`))
+	}))
+	defer proxy.Close()
+
+	clients := NewClients(&models.Transport{ProxyURL: proxy.URL})
+	if body, err := fetchWith(t, clients, models.Endpoint{Endpoint: "http://feed.example/ticker"}); err != nil || string(body) != `{"v": 1}` {
+		t.Errorf("Expected the request to be sent through the proxy, got %q, %v", body, err)
+	}
+	if proxied != "http://feed.example/ticker" {
+		t.Errorf("Expected the proxy to receive the request, got %q", proxied)
+	}
+}
+
+func TestClientsRejectInvalidTransports(t *testing.T) {
+	for _, transport := range []*models.Transport{
+		{RootCAFiles: []string{filepath.Join(tempDir(t), "missing.pem")}},
+		{ClientCertFile: "client.pem"},
+		{MinTLSVersion: "1.4"},
+		{PinnedKeys: []string{"not a hash"}},
+		{ProxyURL: "ftp://proxy.example"},
+	} {
+		if _, err := NewClients(nil).Client(transport); err == nil {
+			t.Errorf("Expected an error for %+v", transport)
+		}
+	}
+}
+
+// tempDir creates a temporary directory that is removed when the test ends
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "oracle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -1,45 +1,156 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 
 	"github.com/hyplabs/dfinity-oracle-framework/models"
 	"github.com/oliveagle/jsonpath"
 )
 
-func getEndpoint(endpoint string) ([]byte, error) {
-	resp, err := http.Get(endpoint)
+// Classes of errors returned by GetAPIInfo, see APIError
+const (
+	ErrorClassRequest    = "request"
+	ErrorClassTimeout    = "timeout"
+	ErrorClassCanceled   = "canceled"
+	ErrorClassConnection = "connection"
+	ErrorClassHTTPStatus = "http_status"
+	ErrorClassParse      = "parse"
+	ErrorClassJSONPath   = "json_path"
+	ErrorClassNormalize  = "normalize"
+	// ErrorClassQuota is the class of requests the oracle skipped to stay within a quota
+	ErrorClassQuota = "quota"
+)
+
+// APIError is an error retrieving information from an endpoint, along with the class of the error
+type APIError struct {
+	Class string
+	Err   error
+}
+
+func (e *APIError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass returns the class of an error returned by GetAPIInfo, or "other" if it has none
+func ErrorClass(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Class
+	}
+	return "other"
+}
+
+// FetchEndpoint sends a request to the given endpoint with its transport settings, returning the body of its response
+func FetchEndpoint(ctx context.Context, e models.Endpoint) ([]byte, error) {
+	client, err := defaultClients.Client(e.Transport)
+	if err != nil {
+		return nil, &APIError{Class: ErrorClassRequest, Err: err}
+	}
+	resp, err := sendRequest(ctx, client, e, nil)
 	if err != nil {
 		return nil, err
 	}
+	return resp.body, nil
+}
+
+// response is a response to a request to an endpoint
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// sendRequest sends a request to the given endpoint with the given client, returning an error unless it succeeds with a 2XX status. If
+// conditions are given, such as If-None-Match, they are sent as headers and a 304 Not Modified status is accepted too.
+func sendRequest(ctx context.Context, client *http.Client, e models.Endpoint, conditions map[string]string) (*response, error) {
+	method := e.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if e.Body != "" {
+		body = strings.NewReader(e.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.Endpoint, body)
+	if err != nil {
+		return nil, &APIError{Class: ErrorClassRequest, Err: err}
+	}
+	for name, value := range e.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range conditions {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &APIError{Class: transportErrorClass(ctx, err), Err: err}
+	}
+	defer resp.Body.Close()
 
 	// Read response body
-	body, err := ioutil.ReadAll(resp.Body)
+	responseBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, &APIError{Class: transportErrorClass(ctx, err), Err: err}
 	}
+	notModified := resp.StatusCode == http.StatusNotModified && len(conditions) > 0
+	if (resp.StatusCode < 200 || resp.StatusCode > 299) && !notModified {
+		return nil, &APIError{Class: ErrorClassHTTPStatus, Err: fmt.Errorf("Endpoint returned HTTP status %s", resp.Status)}
+	}
+
+	return &response{status: resp.StatusCode, header: resp.Header, body: responseBody}, nil
+}
 
-	return body, nil
+// transportErrorClass classifies an error that occurred while sending a request or reading its response
+func transportErrorClass(ctx context.Context, err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(ctx.Err(), context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	}
+	return ErrorClassConnection
 }
 
 // GetAPIInfo takes a given endpoint and parses the endpoint data
 // Currently assumes all output is in map of floats format
 func GetAPIInfo(e models.Endpoint) (map[string]float64, error) {
-	responseBody, err := getEndpoint(e.Endpoint)
+	return GetAPIInfoContext(context.Background(), e)
+}
+
+// GetAPIInfoContext is like GetAPIInfo, but aborts the request when the given context is cancelled
+func GetAPIInfoContext(ctx context.Context, e models.Endpoint) (map[string]float64, error) {
+	responseBody, err := FetchEndpoint(ctx, e)
 	if err != nil {
 		return map[string]float64{}, err
 	}
+	return ParseAPIInfo(responseBody, e)
+}
 
+// ParseAPIInfo extracts the fields of the given endpoint from the body of one of its responses, and normalizes them
+func ParseAPIInfo(responseBody []byte, e models.Endpoint) (map[string]float64, error) {
 	var jsonData interface{}
-	json.Unmarshal(responseBody, &jsonData)
+	if err := json.Unmarshal(responseBody, &jsonData); err != nil {
+		return map[string]float64{}, &APIError{Class: ErrorClassParse, Err: err}
+	}
 
 	result := make(map[string]interface{})
 	for fieldName, jsonPath := range e.JSONPaths {
 		resp, err := jsonpath.JsonPathLookup(jsonData, jsonPath)
 		if err != nil {
-			return map[string]float64{}, err
+			return map[string]float64{}, &APIError{Class: ErrorClassJSONPath, Err: err}
 		}
 		result[fieldName] = resp
 	}
@@ -47,7 +158,7 @@ func GetAPIInfo(e models.Endpoint) (map[string]float64, error) {
 	if e.NormalizeFunc != nil {
 		normalizedResult, err := e.NormalizeFunc(result)
 		if err != nil {
-			return map[string]float64{}, err
+			return map[string]float64{}, &APIError{Class: ErrorClassNormalize, Err: err}
 		}
 		return normalizedResult, nil
 	} else {